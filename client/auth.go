@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func runLogin(ctx context.Context, opts *options, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	email := fs.String("email", os.Getenv("NOTIFY_EMAIL"), "account email (NOTIFY_EMAIL)")
+	password := fs.String("password", "", "password; read from NOTIFY_PASSWORD or stdin if empty")
+	fs.Usage = usage(fs, "login -email EMAIL [-password P]")
+	fs.Parse(args)
+
+	if *email == "" {
+		return errors.New("login: -email is required")
+	}
+	if *password == "" {
+		*password = os.Getenv("NOTIFY_PASSWORD")
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("login: failed to read password: %v", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	var resp struct {
+		Token      string `json:"token"`
+		TOTPSecret string `json:"totp_secret,omitempty"`
+	}
+	if err := postJSON(ctx, opts, "/login", map[string]string{"email": *email, "password": *password}, &resp); err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		printJSON(resp)
+		return nil
+	}
+	fmt.Println(resp.Token)
+	if resp.TOTPSecret != "" {
+		fmt.Fprintf(os.Stderr, "2FA enrolled; add this secret to your authenticator app: %s\n", resp.TOTPSecret)
+	}
+	fmt.Fprintln(os.Stderr, `Complete login with: client 2fa -token <token> -code <totp code>`)
+	return nil
+}
+
+func runVerify2FA(ctx context.Context, opts *options, args []string) error {
+	fs := flag.NewFlagSet("2fa", flag.ExitOnError)
+	token := fs.String("token", opts.token, "token from login (defaults to the global -token)")
+	code := fs.String("code", "", "current TOTP code")
+	fs.Usage = usage(fs, "2fa -token TOKEN -code CODE")
+	fs.Parse(args)
+
+	if *token == "" || *code == "" {
+		return errors.New("2fa: -token and -code are required")
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := postJSON(ctx, opts, "/2fa", map[string]string{"token": *token, "totp_code": *code}, &resp); err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		printJSON(resp)
+		return nil
+	}
+	fmt.Println(resp.Token)
+	fmt.Fprintln(os.Stderr, "Use it with -token or NOTIFY_TOKEN")
+	return nil
+}
+
+// postJSON posts body to the HTTP API and decodes the response into out,
+// turning {"error": ...} responses into errors.
+func postJSON(ctx context.Context, opts *options, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(opts.httpURL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		return fmt.Errorf("%s: %s", path, apiErr.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,34 +1,149 @@
+// Command client is a CLI for the notification API.
+//
+//	client [global flags] <command> [flags] [args]
+//
+// Commands talk to the gRPC server (send, status, list) or the HTTP server
+// (login, 2fa, tail-ws). Global flags can also be set through NOTIFY_*
+// environment variables; run "client -h" for the full list.
 package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+	"user-notification-api/config"
+
 	pb "user-notification-api/proto"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
+// options are the global flags shared by every command
+type options struct {
+	addr       string
+	httpURL    string
+	useTLS     bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+	token      string
+	apiKey     string
+	output     string
+	timeout    time.Duration
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, opts *options, args []string) error
+}
+
+var commands = []command{
+	{"send", "send a notification to one or more recipients", runSend},
+	{"status", "show or watch the status of notifications", runStatus},
+	{"list", "list notifications", runList},
+	{"login", "log in with email and password", runLogin},
+	{"2fa", "exchange a login token and TOTP code for a full token", runVerify2FA},
+	{"tail-ws", "print messages received over the WebSocket", runTailWS},
+}
+
 func main() {
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+	log.SetFlags(0)
+	log.SetPrefix("client: ")
+
+	opts := &options{}
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	fs.StringVar(&opts.addr, "addr", envOr("NOTIFY_ADDR", "localhost:50051"), "gRPC server address (NOTIFY_ADDR)")
+	fs.StringVar(&opts.httpURL, "http", envOr("NOTIFY_HTTP", "http://localhost:3000"), "HTTP server URL for login, 2fa and tail-ws (NOTIFY_HTTP)")
+	fs.BoolVar(&opts.useTLS, "tls", envBool("NOTIFY_TLS"), "connect to gRPC with TLS (NOTIFY_TLS)")
+	fs.StringVar(&opts.caFile, "ca", os.Getenv("NOTIFY_CA"), "CA certificate to verify the server, implies -tls (NOTIFY_CA)")
+	fs.StringVar(&opts.certFile, "cert", os.Getenv("NOTIFY_CERT"), "client certificate for mutual TLS, implies -tls (NOTIFY_CERT)")
+	fs.StringVar(&opts.keyFile, "key", os.Getenv("NOTIFY_KEY"), "client private key for mutual TLS (NOTIFY_KEY)")
+	fs.StringVar(&opts.serverName, "server-name", os.Getenv("NOTIFY_SERVER_NAME"), "override the server name checked against its certificate")
+	fs.StringVar(&opts.token, "token", envOr("NOTIFY_TOKEN", os.Getenv("TOKEN")), "JWT from login/2fa (NOTIFY_TOKEN)")
+	fs.StringVar(&opts.apiKey, "api-key", envOr("NOTIFY_API_KEY", os.Getenv("API_KEY")), "API key, used instead of -token (NOTIFY_API_KEY)")
+	fs.StringVar(&opts.output, "o", envOr("NOTIFY_OUTPUT", "table"), "output format: table or json (NOTIFY_OUTPUT)")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout for each request; streaming commands run until interrupted")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: client [global flags] <command> [flags] [args]\n\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(fs.Output(), "  %-8s %s\n", c.name, c.summary)
+		}
+		fmt.Fprintf(fs.Output(), "\nGlobal flags:\n")
+		fs.PrintDefaults()
 	}
-	defer conn.Close()
+	fs.Parse(os.Args[1:])
 
-	client := pb.NewNotificationServiceClient(conn)
-	req := &pb.NotificationRequest{
-		Email:   "testuser@example.com",
-		Subject: "Test gRPC Notification",
-		Message: "Hello from gRPC!",
+	if opts.output != "table" && opts.output != "json" {
+		log.Fatalf("unknown output format %q", opts.output)
 	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	resp, err := client.SendNotification(context.Background(), req)
+	name, args := fs.Arg(0), fs.Args()[1:]
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(ctx, opts, args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Printf("unknown command %q", name)
+	fs.Usage()
+	os.Exit(2)
+}
+
+// dial connects to the gRPC server
+func (o *options) dial() (pb.NotificationServiceClient, func(), error) {
+	creds := insecure.NewCredentials()
+	if o.useTLS || o.caFile != "" || o.certFile != "" {
+		tlsConfig, err := config.ClientTLS(o.caFile, o.certFile, o.keyFile, o.serverName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid TLS configuration: %v", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(o.addr, grpc.WithTransportCredentials(creds))
 	if err != nil {
-		log.Fatalf("Failed to send notification: %v", err)
+		return nil, nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	return pb.NewNotificationServiceClient(conn), func() { conn.Close() }, nil
+}
+
+// authContext attaches the API key or token as gRPC metadata
+func (o *options) authContext(ctx context.Context) context.Context {
+	if o.apiKey != "" {
+		return metadata.AppendToOutgoingContext(ctx, "x-api-key", o.apiKey)
 	}
-	if resp.Success {
-		log.Println("Notification sent successfully")
-	} else {
-		log.Printf("Notification failed: %s", resp.Error)
+	if o.token != "" {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+o.token)
 	}
+	return ctx
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envBool(key string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(key))
+	return v
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "user-notification-api/proto"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// stringList is a repeatable, comma-separated flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func runSend(ctx context.Context, opts *options, args []string) error {
+	var to stringList
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	fs.Var(&to, "to", "recipient email; repeatable or comma-separated")
+	toFile := fs.String("to-file", "", `file with one recipient per line ("-" for stdin)`)
+	subject := fs.String("subject", "", "subject line")
+	message := fs.String("message", "", "message body")
+	messageFile := fs.String("message-file", "", `read the body from a file ("-" for stdin)`)
+	category := fs.String("category", "", "preference category, e.g. security or marketing")
+	priority := fs.String("priority", "", "high, normal or low")
+	key := fs.String("idempotency-key", "", "requests sharing a key are delivered at most once")
+	at := fs.String("at", "", "send at this time (RFC 3339)")
+	in := fs.Duration("in", 0, "send after this delay, e.g. 2h")
+	fs.Usage = usage(fs, "send -to EMAIL [-to EMAIL...] -subject S (-message M | -message-file F)")
+	fs.Parse(args)
+
+	if *toFile == "-" && *messageFile == "-" {
+		return errors.New("send: only one of -to-file and -message-file can read stdin")
+	}
+	if *toFile != "" {
+		emails, err := readRecipients(*toFile)
+		if err != nil {
+			return err
+		}
+		to = append(to, emails...)
+	}
+	if *messageFile != "" {
+		body, err := readInput(*messageFile)
+		if err != nil {
+			return err
+		}
+		*message = strings.TrimRight(string(body), "\n")
+	}
+	if len(to) == 0 {
+		return errors.New("send: at least one recipient is required (-to or -to-file)")
+	}
+
+	var sendAt *timestamppb.Timestamp
+	switch {
+	case *at != "" && *in != 0:
+		return errors.New("send: use either -at or -in")
+	case *at != "":
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("send: invalid -at: %v", err)
+		}
+		sendAt = timestamppb.New(t)
+	case *in != 0:
+		sendAt = timestamppb.New(time.Now().Add(*in))
+	}
+
+	client, closeConn, err := opts.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(opts.authContext(ctx), opts.timeout)
+	defer cancel()
+
+	var results []*pb.NotificationResponse
+	if len(to) == 1 {
+		resp, err := client.SendNotification(ctx, &pb.NotificationRequest{
+			Email:          to[0],
+			Subject:        *subject,
+			Message:        *message,
+			IdempotencyKey: *key,
+			SendAt:         sendAt,
+			Category:       *category,
+			Priority:       *priority,
+		})
+		if err != nil {
+			return err
+		}
+		results = []*pb.NotificationResponse{resp}
+	} else {
+		resp, err := client.SendBatch(ctx, &pb.SendBatchRequest{
+			Emails:         to,
+			Subject:        *subject,
+			Message:        *message,
+			IdempotencyKey: *key,
+			SendAt:         sendAt,
+			Category:       *category,
+			Priority:       *priority,
+		})
+		if err != nil {
+			return err
+		}
+		results = resp.Results
+	}
+
+	out := newPrinter(opts.output)
+	out.header("ID", "EMAIL", "STATUS", "DUPLICATE", "ERROR")
+	failed := 0
+	for i, r := range results {
+		if !r.Success {
+			failed++
+		}
+		out.row(r, r.Id, to[i], r.Status, r.Duplicate, r.Error)
+	}
+	out.flush()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifications failed", failed, len(results))
+	}
+	return nil
+}
+
+func runStatus(ctx context.Context, opts *options, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	watch := fs.Bool("watch", false, "stream status changes until every notification is final")
+	fs.Usage = usage(fs, "status [-watch] ID [ID...]")
+	fs.Parse(args)
+
+	ids, err := parseIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("status: at least one notification ID is required")
+	}
+
+	client, closeConn, err := opts.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx = opts.authContext(ctx)
+
+	if *watch {
+		stream, err := client.WatchStatus(ctx, &pb.WatchStatusRequest{Ids: ids})
+		if err != nil {
+			return err
+		}
+		// Rows are printed as they arrive
+		out := newPrinter(opts.output)
+		out.header("ID", "STATUS", "UPDATED", "ERROR")
+		out.flush()
+		for {
+			u, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			out.row(u, u.Id, u.Status, formatTime(u.UpdatedAt), u.Error)
+			out.flush()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	out := newPrinter(opts.output)
+	out.header("ID", "EMAIL", "CATEGORY", "STATUS", "SEND AT", "UPDATED", "ERROR")
+	for _, id := range ids {
+		n, err := client.GetNotification(ctx, &pb.GetNotificationRequest{Id: id})
+		if err != nil {
+			out.flush()
+			return fmt.Errorf("notification %d: %v", id, err)
+		}
+		printNotification(out, n)
+	}
+	out.flush()
+	return nil
+}
+
+func runList(ctx context.Context, opts *options, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	email := fs.String("email", "", "only notifications to this recipient")
+	status := fs.String("status", "", "only notifications with this status")
+	limit := fs.Int("limit", 50, "page size (at most 500)")
+	pageToken := fs.String("page-token", "", "continue from a previous page")
+	all := fs.Bool("all", false, "follow next page tokens until the last page")
+	fs.Usage = usage(fs, "list [-email E] [-status S] [-limit N] [-all]")
+	fs.Parse(args)
+
+	client, closeConn, err := opts.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(opts.authContext(ctx), opts.timeout)
+	defer cancel()
+
+	out := newPrinter(opts.output)
+	out.header("ID", "EMAIL", "CATEGORY", "STATUS", "SEND AT", "UPDATED", "ERROR")
+	token := *pageToken
+	for {
+		resp, err := client.ListNotifications(ctx, &pb.ListNotificationsRequest{
+			Email:     *email,
+			Status:    *status,
+			PageSize:  int32(*limit),
+			PageToken: token,
+		})
+		if err != nil {
+			out.flush()
+			return err
+		}
+		for _, n := range resp.Notifications {
+			printNotification(out, n)
+		}
+		token = resp.NextPageToken
+		if !*all || token == "" {
+			break
+		}
+	}
+	out.flush()
+	if token != "" && opts.output == "table" {
+		fmt.Printf("\nMore results: -page-token %s\n", token)
+	}
+	return nil
+}
+
+func printNotification(out *printer, n *pb.Notification) {
+	out.row(n, n.Id, n.Email, n.Category, n.Status, formatTime(n.SendAt), formatTime(n.UpdatedAt), n.Error)
+}
+
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Local().Format(time.DateTime)
+}
+
+func parseIDs(args []string) ([]int64, error) {
+	var ids []int64
+	for _, a := range args {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification ID %q", a)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func usage(fs *flag.FlagSet, synopsis string) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: client %s\n\n", synopsis)
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// printer writes results as an aligned table or as JSON, one object per line
+type printer struct {
+	json bool
+	tw   *tabwriter.Writer
+}
+
+func newPrinter(format string) *printer {
+	return &printer{
+		json: format == "json",
+		tw:   tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0),
+	}
+}
+
+func (p *printer) header(cols ...string) {
+	if !p.json {
+		fmt.Fprintln(p.tw, strings.Join(cols, "\t"))
+	}
+}
+
+// row prints v in JSON mode and the column values in table mode
+func (p *printer) row(v interface{}, cols ...interface{}) {
+	if p.json {
+		printJSON(v)
+		return
+	}
+	fields := make([]string, len(cols))
+	for i, c := range cols {
+		fields[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(p.tw, strings.Join(fields, "\t"))
+}
+
+func (p *printer) flush() {
+	p.tw.Flush()
+}
+
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+func printJSON(v interface{}) {
+	if m, ok := v.(proto.Message); ok {
+		b, err := protoJSON.Marshal(m)
+		if err == nil {
+			fmt.Println(string(b))
+			return
+		}
+	}
+	json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// readInput reads a whole file, or stdin for "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readRecipients reads emails separated by newlines or commas, skipping
+// blank lines and # comments.
+func readRecipients(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	var emails stringList
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		emails.Set(line)
+	}
+	return emails, scanner.Err()
+}
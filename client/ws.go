@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func runTailWS(ctx context.Context, opts *options, args []string) error {
+	fs := flag.NewFlagSet("tail-ws", flag.ExitOnError)
+	path := fs.String("path", "/ws", "WebSocket path")
+	fs.Usage = usage(fs, "tail-ws [-path /ws]")
+	fs.Parse(args)
+
+	if opts.token == "" && opts.apiKey == "" {
+		return errors.New("tail-ws: -token or -api-key is required")
+	}
+	u, err := url.Parse(strings.TrimRight(opts.httpURL, "/") + *path)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+
+	header := http.Header{}
+	if opts.apiKey != "" {
+		header.Set("X-API-Key", opts.apiKey)
+	} else {
+		header.Set("Authorization", "Bearer "+opts.token)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	conn, _, err := websocket.Dial(dialCtx, u.String(), &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		return fmt.Errorf("tail-ws: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	conn.SetReadLimit(1 << 20)
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				return nil
+			}
+			return fmt.Errorf("tail-ws: %v", err)
+		}
+		printWSMessage(opts.output, data)
+	}
+}
+
+// printWSMessage prints JSON frames as-is in JSON mode and prefixed with the
+// receive time otherwise.
+func printWSMessage(format string, data []byte) {
+	if format == "json" {
+		if json.Valid(data) {
+			fmt.Println(string(data))
+		} else {
+			printJSON(map[string]string{"raw": string(data)})
+		}
+		return
+	}
+	fmt.Printf("%s  %s\n", time.Now().Format(time.TimeOnly), data)
+}
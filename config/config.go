@@ -1 +1,93 @@
 package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// GRPCServerTLS builds the gRPC server TLS config from the environment:
+// GRPC_TLS_CERT and GRPC_TLS_KEY enable TLS, and GRPC_TLS_CLIENT_CA
+// additionally requires clients to present a certificate signed by that CA.
+// It returns nil when TLS is not configured.
+func GRPCServerTLS() (*tls.Config, error) {
+	return ServerTLS(os.Getenv("GRPC_TLS_CERT"), os.Getenv("GRPC_TLS_KEY"), os.Getenv("GRPC_TLS_CLIENT_CA"))
+}
+
+// GRPCGatewayTLS builds the TLS config the HTTP gateway uses to call the
+// local gRPC server, or nil when the server does not use TLS. GRPC_GATEWAY_CA
+// verifies the server certificate against GRPC_GATEWAY_SERVER_NAME (default
+// localhost); GRPC_GATEWAY_CERT and GRPC_GATEWAY_KEY are needed for mTLS.
+func GRPCGatewayTLS() (*tls.Config, error) {
+	if os.Getenv("GRPC_TLS_CERT") == "" {
+		return nil, nil
+	}
+	serverName := os.Getenv("GRPC_GATEWAY_SERVER_NAME")
+	if serverName == "" {
+		serverName = "localhost"
+	}
+	return ClientTLS(os.Getenv("GRPC_GATEWAY_CA"), os.Getenv("GRPC_GATEWAY_CERT"), os.Getenv("GRPC_GATEWAY_KEY"), serverName)
+}
+
+// ServerTLS loads a server certificate and, if clientCAFile is set, enables
+// mutual TLS with client certificate verification.
+func ServerTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientTLS builds a client TLS config. caFile verifies the server (system
+// roots if empty); certFile and keyFile present a client certificate for
+// mutual TLS; serverName overrides the name checked against the server cert.
+func ClientTLS(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA %s: %v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"user-notification-api/middleware"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultLogPage = 100
+	maxLogPage     = 1000
+)
+
+// SetupAdminRoutes registers the admin-only operational endpoints
+func SetupAdminRoutes(app fiber.Router) {
+	admin := app.Group("/admin", middleware.Role("admin"))
+	admin.Get("/logs", GetRequestLogs)
+	admin.Get("/jobs/overview", JobsOverview)
+	admin.Get("/jobs", ListJobs)
+	admin.Post("/jobs/:id/retry", RetryJob)
+	admin.Delete("/jobs/:id", DeleteJob)
+	admin.Post("/jobs/types/:type/pause", PauseJobType)
+	admin.Post("/jobs/types/:type/resume", ResumeJobType)
+	admin.Get("/cron", CronJobs)
+	admin.Get("/cron/runs", CronRuns)
+}
+
+// GetRequestLogs searches the stored request logs, newest first. Filters:
+// user_id, path (prefix), status (e.g. 404, or 5xx for a class), from and
+// to (RFC 3339); before and limit page through the results.
+func GetRequestLogs(c *fiber.Ctx) error {
+	f := services.RequestLogFilter{PathPrefix: c.Query("path")}
+	bad := func(msg string) error {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	var err error
+	if v := c.Query("user_id"); v != "" {
+		if f.UserID, err = strconv.Atoi(v); err != nil || f.UserID <= 0 {
+			return bad("Invalid user_id")
+		}
+	}
+	if v := c.Query("status"); v != "" {
+		if f.StatusMin, f.StatusMax, err = parseStatusFilter(v); err != nil {
+			return bad("status must be a code such as 404 or a class such as 5xx")
+		}
+	}
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return bad(name + " must be an RFC 3339 time")
+			}
+			*dst = &t
+		}
+	}
+	if f.Before, err = strconv.ParseInt(c.Query("before", "0"), 10, 64); err != nil || f.Before < 0 {
+		return bad("Invalid cursor")
+	}
+	f.Limit = c.QueryInt("limit", defaultLogPage)
+	if f.Limit < 1 || f.Limit > maxLogPage {
+		return bad("limit must be between 1 and 1000")
+	}
+
+	logs, err := services.QueryRequestLogs(context.Background(), f)
+	if err != nil {
+		log.Printf("QueryRequestLogs failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load logs"})
+	}
+	resp := fiber.Map{"logs": logs}
+	if len(logs) == f.Limit {
+		resp["next_cursor"] = logs[len(logs)-1].ID
+	}
+	return c.JSON(resp)
+}
+
+// parseStatusFilter turns "404" into 404-404 and "5xx" into 500-599
+func parseStatusFilter(v string) (int, int, error) {
+	if len(v) == 3 && strings.EqualFold(v[1:], "xx") {
+		class, err := strconv.Atoi(v[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, strconv.ErrSyntax
+		}
+		return class * 100, class*100 + 99, nil
+	}
+	code, err := strconv.Atoi(v)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, strconv.ErrSyntax
+	}
+	return code, code, nil
+}
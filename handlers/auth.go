@@ -3,9 +3,9 @@ package handlers
 import (
 	"context"
 
-	"encoding/json"
 	"log"
 	"time"
+	"user-notification-api/middleware"
 	"user-notification-api/services"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,8 +13,6 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pquerna/otp/totp"
 	"github.com/prometheus/client_golang/prometheus"
-
-	"github.com/segmentio/kafka-go"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 )
@@ -53,12 +51,13 @@ func Setuproutes(app *fiber.App) {
 	app.Get("/ws", WebSocketChat)
 }
 
-// Register handles user registration
+// Register handles user registration. Every account starts with the user
+// role whatever the request says; admin and service roles are granted out of
+// band, by updating users.role.
 func Register(c *fiber.Ctx) error {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
-		Role     string `json:"role"`
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
@@ -79,29 +78,36 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Database not available"})
 	}
 	//defer db.Close()
-	_, err = db.Exec(context.Background(),
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save user: " + err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
 		"INSERT INTO users (email, password, role, totp_secret) VALUES ($1, $2, $3, $4)",
-		input.Email, string(hashedPassword), input.Role, key.Secret())
+		input.Email, string(hashedPassword), services.DefaultRole, key.Secret())
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to save user: " + err.Error()})
 	}
 
+	// The welcome email is written to the outbox in the same transaction and
+	// published to Kafka by the outbox relay.
 	msg := services.RegistrationMessage{
 		Email:   input.Email,
 		Subject: "Welcome to User Notification API",
 		Message: "Thanks for registering! Enjoy our services.",
+		// One welcome email per account, even if the event is redelivered
+		IdempotencyKey: "welcome:" + input.Email,
 	}
-	msgBytes, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal Kafka message: %v", err)
-	} else {
-		err = services.KafkaWriter().WriteMessages(context.Background(), kafka.Message{Value: msgBytes})
-		if err != nil {
-			log.Printf("Failed to send Kafka message: %v", err)
-		} else {
-			log.Printf("Sent Kafka message for %s", input.Email)
-		}
+	if err := services.EnqueueOutbox(ctx, tx, services.RegistrationTopic, input.Email, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save user: " + err.Error()})
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save user: " + err.Error()})
+	}
+	log.Printf("Queued welcome email for %s", input.Email)
 
 	return c.Status(201).JSON(fiber.Map{"totp_secret": key.Secret()})
 }
@@ -188,6 +194,11 @@ func Verify2FA(c *fiber.Ctx) error {
 	fullTokenString, err := services.Verify2FA(input.Token, input.TOTPCode)
 	if err != nil {
 		log.Println(err)
+	} else if fullTokenString != input.Token {
+		// A new login, not a token that was already verified
+		if p, err := services.ParseAccessToken(fullTokenString); err == nil {
+			services.NotifyLogin(p.UserID, c.IP(), c.Get("User-Agent"))
+		}
 	}
 	return c.JSON(fiber.Map{"token": fullTokenString})
 }
@@ -217,6 +228,10 @@ func AdminRoute(c *fiber.Ctx) error {
 
 // WebSocketChat handles chat connections
 func WebSocketChat(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(int); ok && websocket.IsWebSocketUpgrade(c) {
+		// Already authenticated by middleware.WSAuth
+		return websocket.New(echoWebSocket, websocket.Config{Subprotocols: []string{middleware.WSSubprotocol}})(c)
+	}
 	if websocket.IsWebSocketUpgrade(c) {
 		tokenString := c.Get("Authorization")
 		if tokenString == "" || len(tokenString) < 8 || tokenString[:7] != "Bearer " {
@@ -236,21 +251,23 @@ func WebSocketChat(c *fiber.Ctx) error {
 			return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
-		return websocket.New(func(conn *websocket.Conn) {
-			defer conn.Close()
-			for {
-				msgType, msg, err := conn.ReadMessage()
-				if err != nil {
-					log.Printf("WebSocket read error: %v", err)
-					return
-				}
-				log.Printf("Received: %s", msg)
-				if err := conn.WriteMessage(msgType, msg); err != nil {
-					log.Printf("WebSocket write error: %v", err)
-					return
-				}
-			}
-		})(c)
+		return websocket.New(echoWebSocket)(c)
 	}
 	return c.Status(400).JSON(fiber.Map{"error": "Not a WebSocket request"})
 }
+
+func echoWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("WebSocket read error: %v", err)
+			return
+		}
+		log.Printf("Received: %s", msg)
+		if err := conn.WriteMessage(msgType, msg); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"user-notification-api/middleware"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultMessagePage = 50
+	maxMessagePage     = 100
+	maxPresenceUsers   = 100
+)
+
+func SetupChatRoutes(app fiber.Router) {
+	app.Get("/rooms", ListRooms)
+	app.Post("/rooms", CreateRoom)
+	app.Get("/rooms/:room/messages", GetRoomMessages)
+	app.Post("/rooms/:room/members", AddRoomMember)
+	app.Delete("/rooms/:room/members/:user_id", RemoveRoomMember)
+	app.Get("/presence", GetPresence)
+
+	app.Post("/messages/:id/report", ReportMessage)
+	admin := middleware.Role("admin")
+	app.Get("/rooms/:room/sanctions", admin, ListSanctions)
+	app.Post("/rooms/:room/sanctions", admin, SanctionUser)
+	app.Delete("/rooms/:room/sanctions/:kind/:user_id", admin, LiftSanction)
+	app.Get("/admin/chat/reports", admin, ListReports)
+	app.Post("/admin/chat/reports/:id", admin, ReviewReport)
+}
+
+// GetPresence returns the presence of the users in ?user_ids=1,2,3
+func GetPresence(c *fiber.Ctx) error {
+	var userIDs []int
+	for _, s := range strings.Split(c.Query("user_ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || id <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_ids must be a comma-separated list of user IDs"})
+		}
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) > maxPresenceUsers {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At most 100 users per request"})
+	}
+	presence, err := services.GetPresence(context.Background(), userIDs)
+	if err != nil {
+		log.Printf("GetPresence failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load presence"})
+	}
+	return c.JSON(fiber.Map{"presence": presence})
+}
+
+// ListRooms returns the public rooms and the caller's private rooms
+func ListRooms(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	rooms, err := services.ListRooms(context.Background(), userID)
+	if err != nil {
+		log.Printf("ListRooms failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list rooms"})
+	}
+	return c.JSON(fiber.Map{"rooms": rooms})
+}
+
+// CreateRoom creates a room owned by the caller
+func CreateRoom(c *fiber.Ctx) error {
+	var input struct {
+		Name    string `json:"name"`
+		Private bool   `json:"private"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	userID := c.Locals("user_id").(int)
+	room, err := services.CreateRoom(context.Background(), input.Name, input.Private, userID)
+	switch {
+	case errors.Is(err, services.ErrInvalidRoomName):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrRoomExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("CreateRoom failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create room"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"room": room})
+}
+
+// GetRoomMessages pages through a room's history. Without a cursor it
+// returns the newest messages; next_cursor, when set, is the before (or
+// after) value for the following page.
+func GetRoomMessages(c *fiber.Ctx) error {
+	room, _, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	before, err1 := strconv.ParseInt(c.Query("before", "0"), 10, 64)
+	after, err2 := strconv.ParseInt(c.Query("after", "0"), 10, 64)
+	if err1 != nil || err2 != nil || before < 0 || after < 0 || (before > 0 && after > 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := c.QueryInt("limit", defaultMessagePage)
+	if limit < 1 || limit > maxMessagePage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+
+	messages, err := services.RoomMessages(context.Background(), room.Name, before, after, limit)
+	if err != nil {
+		log.Printf("RoomMessages failed for %q: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load messages"})
+	}
+	resp := fiber.Map{"messages": messages}
+	if len(messages) == limit {
+		resp["next_cursor"] = messages[len(messages)-1].ID
+	}
+	return c.JSON(resp)
+}
+
+// AddRoomMember lets a room's owner or an admin add a user to the room
+func AddRoomMember(c *fiber.Ctx) error {
+	room, memberRole, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	if !services.CanManageRoom(c.Locals("role").(string), memberRole) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only room owners can add members"})
+	}
+	var input struct {
+		UserID int `json:"user_id"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.UserID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if err := services.AddRoomMember(context.Background(), room.Name, input.UserID, models.RoomMember); err != nil {
+		log.Printf("AddRoomMember failed for room %s: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add member"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RemoveRoomMember removes a user from a room. Members may remove
+// themselves; owners and admins anyone. The user's open connections stop
+// receiving the room right away.
+func RemoveRoomMember(c *fiber.Ctx) error {
+	room, memberRole, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	target, err := strconv.Atoi(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	if target != c.Locals("user_id").(int) && !services.CanManageRoom(c.Locals("role").(string), memberRole) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only room owners can remove members"})
+	}
+	if err := services.RemoveRoomMember(context.Background(), room.Name, target); err != nil {
+		log.Printf("RemoveRoomMember failed for room %s: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// visibleRoom loads the room in :room with the caller's role in it. Private
+// rooms look missing to non-members. On failure it writes the error response
+// and returns nil.
+func visibleRoom(c *fiber.Ctx) (*models.ChatRoom, string, error) {
+	ctx := context.Background()
+	userID := c.Locals("user_id").(int)
+	room, err := services.GetRoom(ctx, c.Params("room"))
+	if errors.Is(err, services.ErrRoomNotFound) {
+		return nil, "", c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if err != nil {
+		log.Printf("GetRoom failed for %q: %v", c.Params("room"), err)
+		return nil, "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load room"})
+	}
+	memberRole, err := services.RoomMemberRole(ctx, room.Name, userID)
+	if err != nil {
+		log.Printf("RoomMemberRole failed for %q: %v", room.Name, err)
+		return nil, "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load room"})
+	}
+	if services.AuthorizeRoomJoin(room, c.Locals("role").(string), memberRole != "") != nil {
+		return nil, "", c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	return room, memberRole, nil
+}
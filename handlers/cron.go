@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultCronRunPage = 50
+	maxCronRunPage     = 500
+)
+
+// cronJobStatus is a registered cron job with its latest run
+type cronJobStatus struct {
+	services.CronJobInfo
+	LastRun *models.CronRun `json:"last_run"`
+}
+
+// CronJobs lists the cron jobs with their schedule, next run and latest run,
+// and whether this instance is the leader that starts them
+func CronJobs(c *fiber.Ctx) error {
+	cron := services.DefaultCron()
+	if cron == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Cron scheduler not running"})
+	}
+	last, err := services.LastCronRuns(context.Background())
+	if err != nil {
+		log.Printf("LastCronRuns failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load cron runs"})
+	}
+	jobs := []cronJobStatus{}
+	for _, j := range cron.Jobs() {
+		status := cronJobStatus{CronJobInfo: j}
+		if run, ok := last[j.Name]; ok {
+			status.LastRun = &run
+		}
+		jobs = append(jobs, status)
+	}
+	return c.JSON(fiber.Map{"instance": cron.Instance(), "leader": cron.IsLeader(), "jobs": jobs})
+}
+
+// CronRuns lists cron runs, newest first, optionally of one job and status;
+// before and limit page through them
+func CronRuns(c *fiber.Ctx) error {
+	f := services.CronRunFilter{Job: c.Query("job"), Status: c.Query("status")}
+	switch f.Status {
+	case "", models.CronRunning, models.CronSucceeded, models.CronFailed:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status must be running, succeeded or failed"})
+	}
+	var err error
+	if f.Before, err = strconv.ParseInt(c.Query("before", "0"), 10, 64); err != nil || f.Before < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	f.Limit = c.QueryInt("limit", defaultCronRunPage)
+	if f.Limit < 1 || f.Limit > maxCronRunPage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+	runs, err := services.ListCronRuns(context.Background(), f)
+	if err != nil {
+		log.Printf("ListCronRuns failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load cron runs"})
+	}
+	resp := fiber.Map{"runs": runs}
+	if len(runs) == f.Limit {
+		resp["next_cursor"] = runs[len(runs)-1].ID
+	}
+	return c.JSON(resp)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bufio"
+	"strconv"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sseRetry is how long browsers wait before reconnecting a dropped stream
+const sseRetry = "3000"
+
+// Events streams the caller's notification events as Server-Sent Events, for
+// clients behind proxies that break WebSockets. A reconnecting client sends
+// Last-Event-ID (or ?last_event_id=) and first receives the notifications it
+// missed from its inbox.
+func Events(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var after int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Last-Event-ID"})
+		}
+		after = id
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Stops nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		w.WriteString("retry: " + sseRetry + "\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+		conn := services.NewSSEConn(w)
+		client := services.RegisterSSE(userID, conn, after)
+		<-conn.Done()
+		services.WSHub().Unregister(client)
+	})
+	return nil
+}
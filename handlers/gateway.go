@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	pb "user-notification-api/proto"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// gatewayHeaders are forwarded to the gRPC server as metadata in addition to
+// the gateway defaults (Authorization and Grpc-Metadata-*).
+var gatewayHeaders = map[string]string{
+	"x-api-key":    "x-api-key",
+	"x-request-id": "x-request-id",
+}
+
+// NewGateway returns the HTTP/JSON facade for NotificationService generated
+// from the google.api.http annotations in proto/notification.proto. Calls go
+// through conn, so they pass the same interceptors as native gRPC clients.
+func NewGateway(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			if md, ok := gatewayHeaders[strings.ToLower(key)]; ok {
+				return md, true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			if key == "x-request-id" {
+				return "X-Request-Id", true
+			}
+			return "", false
+		}),
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithErrorHandler(gatewayError),
+	)
+	if err := pb.RegisterNotificationServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// gatewayError renders gRPC errors like the rest of the HTTP API
+func gatewayError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	s := status.Convert(err)
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		if id := md.HeaderMD.Get("x-request-id"); len(id) > 0 {
+			w.Header().Set("X-Request-Id", id[0])
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(s.Code()))
+	json.NewEncoder(w).Encode(fiber.Map{"error": s.Message()})
+}
+
+// SetupGatewayRoutes serves the gateway under /v1
+func SetupGatewayRoutes(app fiber.Router, gateway http.Handler) {
+	app.All("/v1/*", adaptor.HTTPHandler(gateway))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultInboxPage = 50
+	maxInboxPage     = 100
+)
+
+// GetInbox lists the caller's inbox, newest first. ?unread=true leaves out
+// read items; next_cursor, when set, is the before value for the next page.
+func GetInbox(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	before, err := strconv.ParseInt(c.Query("before", "0"), 10, 64)
+	if err != nil || before < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := c.QueryInt("limit", defaultInboxPage)
+	if limit < 1 || limit > maxInboxPage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+
+	ctx := context.Background()
+	items, err := services.ListInbox(ctx, userID, c.QueryBool("unread"), before, limit)
+	if err != nil {
+		log.Printf("ListInbox failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load inbox"})
+	}
+	unread, err := services.UnreadCount(ctx, userID)
+	if err != nil {
+		log.Printf("UnreadCount failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load inbox"})
+	}
+	resp := fiber.Map{"items": items, "unread": unread}
+	if len(items) == limit {
+		resp["next_cursor"] = items[len(items)-1].ID
+	}
+	return c.JSON(resp)
+}
+
+// MarkInboxRead marks one inbox item read
+func MarkInboxRead(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid inbox item ID"})
+	}
+	ctx := context.Background()
+	err = services.MarkInboxRead(ctx, userID, id)
+	if errors.Is(err, services.ErrInboxItemNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Inbox item not found"})
+	}
+	if err != nil {
+		log.Printf("MarkInboxRead failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update inbox"})
+	}
+	services.PushUnreadCount(ctx, userID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// MarkAllInboxRead marks every item in the caller's inbox read
+func MarkAllInboxRead(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	ctx := context.Background()
+	n, err := services.MarkAllInboxRead(ctx, userID)
+	if err != nil {
+		log.Printf("MarkAllInboxRead failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update inbox"})
+	}
+	if n > 0 {
+		services.PushUnreadCount(ctx, userID)
+	}
+	return c.JSON(fiber.Map{"marked": n})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultJobPage = 50
+	maxJobPage     = 500
+)
+
+// defaultJobQueue returns the job queue, or nil after answering 503 when
+// there is none
+func defaultJobQueue(c *fiber.Ctx) (*services.JobQueue, error) {
+	q := services.DefaultJobQueue()
+	if q == nil {
+		return nil, c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Job queue not available"})
+	}
+	return q, nil
+}
+
+// JobsOverview reports the job counts by state, the job types and whether
+// they are paused, and this replica's Kafka consumers. queue is null when
+// the job queue is not available.
+func JobsOverview(c *fiber.Ctx) error {
+	resp := fiber.Map{"queue": nil, "kafka_consumers": services.KafkaConsumers()}
+	if q := services.DefaultJobQueue(); q != nil {
+		overview, err := q.Overview(context.Background())
+		if err != nil {
+			log.Printf("Job queue overview failed: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load job queue"})
+		}
+		resp["queue"] = overview
+	}
+	return c.JSON(resp)
+}
+
+// ListJobs lists the jobs in one state (default queued) with their payload
+// and last error, paged with offset and limit
+func ListJobs(c *fiber.Ctx) error {
+	q, err := defaultJobQueue(c)
+	if q == nil {
+		return err
+	}
+	offset := c.QueryInt("offset", 0)
+	limit := c.QueryInt("limit", defaultJobPage)
+	if offset < 0 || limit < 1 || limit > maxJobPage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500 and offset not negative"})
+	}
+	jobs, err := q.ListJobs(context.Background(), c.Query("state", models.JobQueued), int64(offset), int64(limit))
+	if errors.Is(err, services.ErrInvalidJobState) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("ListJobs failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list jobs"})
+	}
+	return c.JSON(fiber.Map{"jobs": jobs})
+}
+
+// RetryJob queues a failed job again
+func RetryJob(c *fiber.Ctx) error {
+	q, err := defaultJobQueue(c)
+	if q == nil {
+		return err
+	}
+	job, err := q.RetryJob(context.Background(), c.Params("id"))
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Job not found"})
+	case errors.Is(err, services.ErrJobNotFailed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("RetryJob failed for %s: %v", c.Params("id"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retry job"})
+	}
+	return c.JSON(fiber.Map{"job": job})
+}
+
+// DeleteJob removes a job that is not running
+func DeleteJob(c *fiber.Ctx) error {
+	q, err := defaultJobQueue(c)
+	if q == nil {
+		return err
+	}
+	err = q.DeleteJob(context.Background(), c.Params("id"))
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Job not found"})
+	case errors.Is(err, services.ErrJobRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Job is running"})
+	case err != nil:
+		log.Printf("DeleteJob failed for %s: %v", c.Params("id"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete job"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PauseJobType stops workers from starting jobs of a type
+func PauseJobType(c *fiber.Ctx) error {
+	q, err := defaultJobQueue(c)
+	if q == nil {
+		return err
+	}
+	err = q.PauseType(context.Background(), c.Params("type"))
+	if errors.Is(err, services.ErrUnknownJobType) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown job type"})
+	}
+	if err != nil {
+		log.Printf("PauseType failed for %s: %v", c.Params("type"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to pause job type"})
+	}
+	return c.JSON(fiber.Map{"type": c.Params("type"), "paused": true})
+}
+
+// ResumeJobType lets workers run jobs of a type again, returning how many
+// jobs were set aside while it was paused
+func ResumeJobType(c *fiber.Ctx) error {
+	q, err := defaultJobQueue(c)
+	if q == nil {
+		return err
+	}
+	n, err := q.ResumeType(context.Background(), c.Params("type"))
+	if errors.Is(err, services.ErrUnknownJobType) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown job type"})
+	}
+	if err != nil {
+		log.Printf("ResumeType failed for %s: %v", c.Params("type"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resume job type"})
+	}
+	return c.JSON(fiber.Map{"type": c.Params("type"), "paused": false, "requeued": n})
+}
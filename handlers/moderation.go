@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultReportPage = 50
+	maxReportPage     = 100
+	maxReportReason   = 500
+)
+
+// SanctionUser mutes or bans a user in a room, optionally for a duration
+// such as "24h"
+func SanctionUser(c *fiber.Ctx) error {
+	room, _, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	var input struct {
+		UserID   int    `json:"user_id"`
+		Kind     string `json:"kind"`
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.UserID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	s := &models.RoomSanction{
+		Room:      room.Name,
+		UserID:    input.UserID,
+		Kind:      input.Kind,
+		Reason:    input.Reason,
+		CreatedBy: c.Locals("user_id").(int),
+	}
+	if input.Duration != "" {
+		d, err := time.ParseDuration(input.Duration)
+		if err != nil || d <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "duration must be a positive Go duration such as 24h"})
+		}
+		expires := time.Now().Add(d).UTC()
+		s.ExpiresAt = &expires
+	}
+	err = services.SanctionUser(context.Background(), s)
+	if errors.Is(err, services.ErrInvalidSanction) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("SanctionUser failed for room %s: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save sanction"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"sanction": s})
+}
+
+// LiftSanction removes a mute or ban
+func LiftSanction(c *fiber.Ctx) error {
+	room, _, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	target, err := strconv.Atoi(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	err = services.LiftSanction(context.Background(), room.Name, target, c.Params("kind"))
+	if errors.Is(err, services.ErrSanctionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sanction not found"})
+	}
+	if err != nil {
+		log.Printf("LiftSanction failed for room %s: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to lift sanction"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListSanctions returns a room's current mutes and bans
+func ListSanctions(c *fiber.Ctx) error {
+	room, _, err := visibleRoom(c)
+	if room == nil {
+		return err
+	}
+	sanctions, err := services.ListSanctions(context.Background(), room.Name)
+	if err != nil {
+		log.Printf("ListSanctions failed for room %s: %v", room.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load sanctions"})
+	}
+	return c.JSON(fiber.Map{"sanctions": sanctions})
+}
+
+// ReportMessage reports a chat message the caller can see for review
+func ReportMessage(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid message ID"})
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil || len(input.Reason) > maxReportReason {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	userID := c.Locals("user_id").(int)
+	report, err := services.ReportMessage(context.Background(), userID, c.Locals("role").(string), id, input.Reason)
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrRoomNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+	case errors.Is(err, services.ErrAlreadyReported):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("ReportMessage failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to report message"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"report": report})
+}
+
+// ListReports pages through chat reports, newest first; ?status= filters
+// by open, dismissed or actioned
+func ListReports(c *fiber.Ctx) error {
+	status := c.Query("status")
+	switch status {
+	case "", models.ReportOpen, models.ReportDismissed, models.ReportActioned:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status must be open, dismissed or actioned"})
+	}
+	before, err := strconv.ParseInt(c.Query("before", "0"), 10, 64)
+	if err != nil || before < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := c.QueryInt("limit", defaultReportPage)
+	if limit < 1 || limit > maxReportPage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+	reports, err := services.ListReports(context.Background(), status, before, limit)
+	if err != nil {
+		log.Printf("ListReports failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load reports"})
+	}
+	resp := fiber.Map{"reports": reports}
+	if len(reports) == limit {
+		resp["next_cursor"] = reports[len(reports)-1].ID
+	}
+	return c.JSON(resp)
+}
+
+// ReviewReport closes a report as dismissed or actioned
+func ReviewReport(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	err = services.ReviewReport(context.Background(), id, c.Locals("user_id").(int), input.Status)
+	switch {
+	case errors.Is(err, services.ErrInvalidReportStatus):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrReportNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Report not found"})
+	case err != nil:
+		log.Printf("ReviewReport failed for report %d: %v", id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update report"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"user-notification-api/middleware"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupNotificationRoutes(app fiber.Router) {
+	app.Post("/notifications", middleware.Permission(middleware.PermSendNotifications), SendNotification)
+	app.Get("/notifications/:id", middleware.Permission(middleware.PermReadNotifications), GetNotification)
+	app.Delete("/notifications/:id", middleware.Permission(middleware.PermSendNotifications), CancelNotification)
+	app.Get("/me/preferences", GetPreferences)
+	app.Put("/me/preferences", UpdatePreferences)
+	app.Get("/me/inbox", GetInbox)
+	app.Post("/me/inbox/read", MarkAllInboxRead)
+	app.Post("/me/inbox/:id/read", MarkInboxRead)
+}
+
+// SendNotification sends an email, honouring the Idempotency-Key header.
+// With send_at (RFC 3339) or delay (e.g. "72h") it is scheduled instead.
+func SendNotification(c *fiber.Ctx) error {
+	var input struct {
+		Email    string     `json:"email"`
+		Category string     `json:"category"`
+		Priority string     `json:"priority"`
+		Subject  string     `json:"subject"`
+		Message  string     `json:"message"`
+		SendAt   *time.Time `json:"send_at"`
+		Delay    string     `json:"delay"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	category, err := services.NormalizeCategory(input.Category)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	input.Category = category
+
+	key := c.Get("Idempotency-Key")
+	if input.SendAt != nil || input.Delay != "" {
+		n := &models.Notification{
+			Email:          input.Email,
+			Category:       input.Category,
+			Priority:       input.Priority,
+			Subject:        input.Subject,
+			Message:        input.Message,
+			IdempotencyKey: key,
+		}
+		return scheduleNotification(c, n, input.SendAt, input.Delay)
+	}
+
+	result, err := services.Dispatch(context.Background(), services.RegistrationMessage{
+		Email:          input.Email,
+		Category:       input.Category,
+		Priority:       input.Priority,
+		Subject:        input.Subject,
+		Message:        input.Message,
+		IdempotencyKey: key,
+		CreatedBy:      c.Locals("user_id").(int),
+		CreatedByName:  principalName(c),
+	})
+	if errors.Is(err, services.ErrIdempotencyUnavailable) {
+		log.Printf("SendNotification deferred for %s: %v", input.Email, err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Notification not sent, try again later"})
+	}
+	if err != nil {
+		log.Printf("SendNotification failed for %s: %v", input.Email, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Failed to send notification"})
+	}
+	if result == services.DispatchDuplicate {
+		return c.JSON(fiber.Map{"success": true, "duplicate": true})
+	}
+	return c.JSON(fiber.Map{"success": true, "status": result})
+}
+
+func scheduleNotification(c *fiber.Ctx, n *models.Notification, sendAt *time.Time, delay string) error {
+	if n.Subject == "" || n.Message == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Subject and message are required"})
+	}
+	n.CreatedBy, n.CreatedByName = c.Locals("user_id").(int), principalName(c)
+	if sendAt != nil {
+		n.SendAt = *sendAt
+	} else {
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid delay"})
+		}
+		n.SendAt = time.Now().Add(d)
+	}
+
+	duplicate, err := services.ScheduleNotification(context.Background(), n)
+	if err != nil {
+		log.Printf("ScheduleNotification failed for %s: %v", n.Email, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to schedule notification"})
+	}
+	if duplicate {
+		return c.JSON(fiber.Map{"notification": n, "duplicate": true})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"notification": n})
+}
+
+// principalName is the API key the caller authenticated with, if any
+func principalName(c *fiber.Ctx) string {
+	name, _ := c.Locals("principal_name").(string)
+	return name
+}
+
+// GetNotification returns a scheduled notification and its status
+func GetNotification(c *fiber.Ctx) error {
+	n, err := ownedNotification(c)
+	if n == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"notification": n})
+}
+
+// CancelNotification cancels a notification that has not been sent yet
+func CancelNotification(c *fiber.Ctx) error {
+	n, err := ownedNotification(c)
+	if n == nil {
+		return err
+	}
+	err = services.CancelNotification(context.Background(), n.ID)
+	if errors.Is(err, services.ErrNotificationNotCancellable) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("CancelNotification failed for %d: %v", n.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel notification"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ownedNotification loads the notification in :id if it is within the
+// caller's services.NotificationScope, as over gRPC. On failure it writes the
+// error response and returns nil.
+func ownedNotification(c *fiber.Ctx) (*models.Notification, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+	}
+	userID, _ := c.Locals("user_id").(int)
+	role, _ := c.Locals("role").(string)
+	scope, err := services.NotificationScope(&services.Principal{UserID: userID, Role: role})
+	if err != nil {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+	n, err := services.GetNotification(context.Background(), id)
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+	}
+	if err != nil {
+		log.Printf("GetNotification failed for %d: %v", id, err)
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load notification"})
+	}
+	if scope != 0 && n.CreatedBy != scope {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+	}
+	return n, nil
+}
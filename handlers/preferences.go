@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPreferences returns the caller's notification preferences
+func GetPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	prefs, err := services.GetPreferences(context.Background(), userID)
+	if err != nil {
+		log.Printf("GetPreferences failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load preferences"})
+	}
+	return c.JSON(prefs)
+}
+
+// UpdatePreferences replaces the caller's notification preferences
+func UpdatePreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	var prefs models.NotificationPreferences
+	if err := c.BodyParser(&prefs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if err := services.ValidatePreferences(&prefs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.SavePreferences(context.Background(), userID, &prefs); err != nil {
+		log.Printf("SavePreferences failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save preferences"})
+	}
+	return GetPreferences(c)
+}
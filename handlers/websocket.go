@@ -1,30 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"log"
-	"sync"
+	"strconv"
+	"user-notification-api/middleware"
+	"user-notification-api/models"
+	"user-notification-api/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	clients   = make(map[*websocket.Conn]int) // Map of WebSocket connections to user IDs
-	clientsMu sync.Mutex                      // Mutex for thread-safe client management
-
-	wsConnections = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "websocket_connections_active",
-			Help: "Number of active WebSocket connections",
-		},
-	)
-)
-
-func init() {
-	prometheus.MustRegister(wsConnections)
-}
-
 func WebSocketHandler(c *fiber.Ctx) error {
 	if websocket.IsWebSocketUpgrade(c) {
 		return c.Next()
@@ -32,38 +19,69 @@ func WebSocketHandler(c *fiber.Ctx) error {
 	return fiber.ErrUpgradeRequired
 }
 
-func SetupWebSocketRoutes(app fiber.Router) {
-	app.Get("/ws", WebSocketHandler, websocket.New(func(c *websocket.Conn) {
+// IssueWSTicket returns a single-use ticket for opening a WebSocket from a
+// browser, which cannot set the Authorization header on the upgrade
+func IssueWSTicket(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+	if userID == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Tickets are issued to users only"})
+	}
+	rdb := services.InitRedis()
+	if rdb == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Tickets unavailable"})
+	}
+	ticket, err := services.IssueWSTicket(context.Background(), rdb, &services.Principal{UserID: userID, Role: c.Locals("role").(string)})
+	if err != nil {
+		log.Printf("IssueWSTicket failed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue ticket"})
+	}
+	return c.JSON(fiber.Map{"ticket": ticket, "expires_in": int(services.WSTicketTTL.Seconds())})
+}
+
+// SetupWebSocketRoutes registers /ws behind auth, which must accept the
+// credentials browsers can send on an upgrade (see middleware.WSAuth)
+func SetupWebSocketRoutes(app fiber.Router, auth fiber.Handler) {
+	app.Get("/ws", auth, WebSocketHandler, websocket.New(func(c *websocket.Conn) {
 		// Extract user ID from JWT (set by middleware.JWTAuth)
 		userID := c.Locals("user_id").(int)
+		role, _ := c.Locals("role").(string)
 
-		// Register client
-		clientsMu.Lock()
-		clients[c] = userID
-		wsConnections.Inc() // Increment active connections
-		clientsMu.Unlock()
+		// Register client; notifications for this user are pushed through the hub.
+		// A reconnecting client passes ?last_seen=<message id> to receive the
+		// direct messages it missed first.
+		hub := services.WSHub()
+		var client *services.WSClient
+		if lastSeen, err := strconv.ParseInt(c.Query("last_seen"), 10, 64); err == nil && lastSeen > 0 {
+			client = hub.RegisterReplay(userID, c, func() ([]models.ChatFrame, error) {
+				return services.DirectMessagesSince(context.Background(), userID, lastSeen, services.ChatReplayLimit)
+			})
+		} else {
+			client = hub.Register(userID, c)
+		}
 		log.Printf("User %d connected to WebSocket", userID)
+		services.PresenceConnect(client)
+
+		defer func() {
+			hub.Unregister(client)
+			services.PresenceDisconnect(client)
+			c.Close()
+			log.Printf("User %d disconnected from WebSocket", userID)
+		}()
 
 		// Send welcome message
-		err := c.WriteJSON(map[string]string{"message": "Welcome to global chat!"})
+		err := client.Send(map[string]string{"message": "Welcome to global chat!"})
 		if err != nil {
 			log.Printf("Failed to send welcome message to user %d: %v", userID, err)
 			return
 		}
 
-		// Handle incoming messages
-		defer func() {
-			clientsMu.Lock()
-			delete(clients, c)
-			wsConnections.Dec() // Decrement active connections
-			clientsMu.Unlock()
-			c.Close()
-			log.Printf("User %d disconnected from WebSocket", userID)
-		}()
-
+		// Handle incoming chat frames. Oversized frames close the connection;
+		// frames over the rate limit are rejected.
+		c.SetReadLimit(services.MaxChatFrameSize)
+		limiter := services.NewTokenBucket(services.ChatRateLimit, services.ChatRateBurst)
 		for {
-			var msg map[string]string
-			err := c.ReadJSON(&msg)
+			var frame models.ChatFrame
+			err := c.ReadJSON(&frame)
 			if err != nil {
 				if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					break
@@ -72,20 +90,20 @@ func SetupWebSocketRoutes(app fiber.Router) {
 				break
 			}
 
-			// Broadcast message to all connected clients
-			clientsMu.Lock()
-			for client, id := range clients {
-				err = client.WriteJSON(map[string]interface{}{
-					"user_id": userID,
-					"message": msg["message"],
-				})
-				if err != nil {
-					log.Printf("Failed to send message to user %d: %v", id, err)
-					client.Close()
-					delete(clients, client)
+			if !limiter.Allow() {
+				services.RejectChatFrame(client, &frame, services.ErrRateLimited)
+				continue
+			}
+
+			// Frames without a type are the original global chat: broadcast
+			// to all connected clients, on every instance
+			if frame.Type == "" {
+				if err := services.PostGlobalChat(context.Background(), userID, frame.Message); err != nil {
+					services.RejectChatFrame(client, &frame, err)
 				}
+				continue
 			}
-			clientsMu.Unlock()
+			services.HandleChatFrame(context.Background(), client, role, &frame)
 		}
-	}))
+	}, websocket.Config{Subprotocols: []string{middleware.WSSubprotocol}}))
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	"user-notification-api/config"
 	"user-notification-api/handlers"
 	"user-notification-api/middleware"
 	"user-notification-api/services"
@@ -13,6 +18,11 @@ import (
 	"github.com/ansrivas/fiberprometheus/v2"
 	"github.com/gofiber/fiber/v2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
@@ -28,12 +38,19 @@ func main() {
 	app.Post("/login", handlers.Login)
 	app.Post("/2fa", handlers.Verify2FA)
 	app.Get("/admin", handlers.AdminRoute)
-	app.Get("/ws/chat", handlers.WebSocketChat)
+	// WebSocket upgrades and event streams authenticate with a ticket or the
+	// Authorization header, so they are registered ahead of JWTAuth
+	app.Get("/ws/chat", middleware.WSAuth(), handlers.WebSocketChat)
+	handlers.SetupWebSocketRoutes(app, middleware.WSAuth())
+	app.Get("/events", middleware.WSAuth(), handlers.Events)
 
 	//handlers.Setuproutes(app) // Public
 	protected := app.Group("", middleware.JWTAuth())
 	//handlers.SetupUserRoutes(protected)
-	handlers.SetupWebSocketRoutes(protected)
+	protected.Post("/ws/ticket", handlers.IssueWSTicket)
+	handlers.SetupNotificationRoutes(protected)
+	handlers.SetupChatRoutes(protected)
+	handlers.SetupAdminRoutes(protected)
 
 	// Initialize services
 	dbFunc := services.InitDB()
@@ -42,29 +59,102 @@ func main() {
 	}
 
 	services.InitRedis()
+	services.SetChatFilters(services.ChatFiltersFromEnv()...)
 
-	// Start Kafka consumer in background
-	go services.StartEmailConsumer()
+	// Background workers stop when SIGINT or SIGTERM cancels ctx
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Start Kafka consumer, outbox relay, scheduler, cron maintenance jobs, the WebSocket backplane, job workers and the request log pipeline in background
+	emailConsumerDone := make(chan struct{})
+	go func() {
+		defer close(emailConsumerDone)
+		services.StartEmailConsumer(ctx)
+	}()
+	go services.StartOutboxRelay(ctx)
+	go services.StartScheduler(ctx)
+	go services.StartCron(ctx)
+	go services.StartWSBackplane(ctx)
+	go services.StartPresence(ctx)
+	go services.StartJobs(ctx)
+	go services.StartRequestLogPublisher(ctx)
+	go services.StartRequestLogConsumer(ctx)
+
+	// gRPC server with health checking and optional reflection
+	opts := []grpc.ServerOption{
+		middleware.GRPCUnaryInterceptors(),
+		middleware.GRPCStreamInterceptors(),
+	}
+	tlsConfig, err := config.GRPCServerTLS()
+	if err != nil {
+		log.Fatalf("Invalid gRPC TLS configuration: %v", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		log.Printf("gRPC TLS enabled (mutual TLS: %v)", tlsConfig.ClientCAs != nil)
+	}
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterNotificationServiceServer(grpcServer, &services.NotificationServer{})
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go services.StartHealthChecks(ctx, healthServer)
+
+	if os.Getenv("GRPC_REFLECTION") == "true" {
+		reflection.Register(grpcServer)
+		log.Println("gRPC reflection enabled")
+	}
+
+	// HTTP/JSON gateway on the Fiber port, proxying to the gRPC server. It sits
+	// behind JWTAuth so the caller's own credentials are always forwarded.
+	gatewayCreds := insecure.NewCredentials()
+	gatewayTLS, err := config.GRPCGatewayTLS()
+	if err != nil {
+		log.Fatalf("Invalid gRPC gateway TLS configuration: %v", err)
+	}
+	if gatewayTLS != nil {
+		gatewayCreds = credentials.NewTLS(gatewayTLS)
+	}
+	gatewayConn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(gatewayCreds))
+	if err != nil {
+		log.Fatalf("Failed to create gRPC gateway client: %v", err)
+	}
+	defer gatewayConn.Close()
+	gateway, err := handlers.NewGateway(ctx, gatewayConn)
+	if err != nil {
+		log.Fatalf("Failed to register gRPC gateway: %v", err)
+	}
+	handlers.SetupGatewayRoutes(protected, gateway)
 
-	// Start Fiber server
 	go func() {
-		// Start gRPC server
 		lis, err := net.Listen("tcp", ":50051")
 		if err != nil {
 			log.Printf("Failed to listen for gRPC: %v; gRPC server not starting", err)
-		} else {
-			grpcServer := grpc.NewServer()
-			pb.RegisterNotificationServiceServer(grpcServer, &services.NotificationServer{})
-			log.Println("gRPC server starting on :50051")
-			if err := grpcServer.Serve(lis); err != nil {
-				log.Printf("gRPC server failed: %v", err)
-			}
+			return
+		}
+		log.Println("gRPC server starting on :50051")
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Printf("gRPC server failed: %v", err)
+		}
+	}()
+
+	// Start Fiber server
+	go func() {
+		log.Println("Starting Fiber server on :3000")
+		if err := app.Listen(":3000"); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
-	log.Println("Starting Fiber server on :3000")
-	if err := app.Listen(":3000"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+	shutdown(app, grpcServer, healthServer)
+	// Let the email consumer finish the message it is sending
+	select {
+	case <-emailConsumerDone:
+	case <-time.After(shutdownTimeout):
+		log.Println("Email consumer did not stop in time")
 	}
 	/*app := fiber.New()
 	app.Use(middleware.Logging())
@@ -81,3 +171,35 @@ func main() {
 
 	app.Listen(":3000")*/
 }
+
+// shutdownTimeout bounds how long in-flight requests and streams may take to
+// finish; it must stay below the pod's terminationGracePeriodSeconds.
+const shutdownTimeout = 20 * time.Second
+
+// shutdown marks the service NOT_SERVING so probes stop routing traffic, then
+// drains the gRPC and HTTP servers in parallel. Event streams are closed
+// first since they never finish on their own; gRPC streams still open at the
+// deadline are closed forcibly.
+func shutdown(app *fiber.App, grpcServer *grpc.Server, healthServer *health.Server) {
+	healthServer.Shutdown()
+	deadline := time.After(shutdownTimeout)
+	services.CloseSSEStreams()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Printf("Fiber shutdown: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-deadline:
+		log.Println("gRPC graceful stop timed out; closing remaining streams")
+		grpcServer.Stop()
+	}
+	log.Println("Shutdown complete")
+}
@@ -4,29 +4,49 @@ import (
 	"strings"
 	"user-notification-api/services"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gofiber/fiber/v2"
 )
 
+// JWTAuth accepts a full JWT in the Authorization header or an API key in
+// X-API-Key; the same credentials are accepted by the gRPC server.
 func JWTAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if p, ok := services.LookupAPIKey(c.Get("X-API-Key")); ok {
+			c.Locals("user_id", p.UserID)
+			c.Locals("principal_name", p.Name)
+			c.Locals("role", p.Role)
+			return c.Next()
+		}
 		authHeader := c.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "No Bearer token provided"})
 		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return services.JWTSecret(), nil
-		})
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
-		}
-		claims := token.Claims.(jwt.MapClaims)
-		if !claims["2fa"].(bool) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "2FA required"})
+		return withAccessToken(c, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+}
+
+// withAccessToken continues as the user of a full JWT, or rejects the request
+func withAccessToken(c *fiber.Ctx, tokenStr string) error {
+	p, err := services.ParseAccessToken(tokenStr)
+	if err == services.Err2FARequired {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "2FA required"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	c.Locals("user_id", p.UserID)
+	c.Locals("role", p.Role)
+	return c.Next()
+}
+
+// Permission lets the request through only if the caller's role grants perm,
+// the same check the gRPC interceptors make for each RPC
+func Permission(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !HasPermission(role, perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
 		}
-		c.Locals("user_id", int(claims["id"].(float64)))
-		c.Locals("role", claims["role"].(string))
 		return c.Next()
 	}
 }
@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+	"time"
+	"user-notification-api/services"
+
+	pb "user-notification-api/proto"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// Permissions checked per RPC
+const (
+	PermSendNotifications = "notifications:send"
+	PermReadNotifications = "notifications:read"
+)
+
+var (
+	// grpcMethodPermissions lists the permission each RPC requires; methods
+	// not listed here are rejected unless they are public.
+	grpcMethodPermissions = map[string]string{
+		pb.NotificationService_SendNotification_FullMethodName:   PermSendNotifications,
+		pb.NotificationService_SendBatch_FullMethodName:          PermSendNotifications,
+		pb.NotificationService_CancelNotification_FullMethodName: PermSendNotifications,
+		pb.NotificationService_GetNotification_FullMethodName:    PermReadNotifications,
+		pb.NotificationService_ListNotifications_FullMethodName:  PermReadNotifications,
+		pb.NotificationService_WatchStatus_FullMethodName:        PermReadNotifications,
+	}
+
+	// grpcPublicMethods need no credentials: health probes, and reflection
+	// when it is enabled with GRPC_REFLECTION
+	grpcPublicMethods = map[string]bool{
+		healthpb.Health_Check_FullMethodName:                                   true,
+		healthpb.Health_Watch_FullMethodName:                                   true,
+		reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName:      true,
+		reflectionv1alpha.ServerReflection_ServerReflectionInfo_FullMethodName: true,
+	}
+
+	rolePermissions = map[string][]string{
+		"admin":   {PermSendNotifications, PermReadNotifications},
+		"service": {PermSendNotifications, PermReadNotifications},
+		"user":    {PermReadNotifications},
+	}
+
+	grpcRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_requests_total",
+			Help: "Total number of gRPC requests by method and status code",
+		},
+		[]string{"method", "code"},
+	)
+	grpcDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_request_duration_seconds",
+			Help:    "gRPC request latency by method",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+)
+
+const requestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+func init() {
+	prometheus.MustRegister(grpcRequests, grpcDuration)
+}
+
+// RequestIDFromContext returns the ID assigned by the request ID interceptor
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// HasPermission reports whether role grants perm
+func HasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// wrappedStream lets stream interceptors replace the stream context
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
+
+// GRPCUnaryInterceptors returns the interceptor chain for unary RPCs:
+// panic recovery, request IDs, logging and metrics, then authentication.
+func GRPCUnaryInterceptors() grpc.ServerOption {
+	return grpc.ChainUnaryInterceptor(unaryRecovery, unaryRequestID, unaryLogging, unaryAuth)
+}
+
+// GRPCStreamInterceptors is the streaming counterpart of GRPCUnaryInterceptors
+func GRPCStreamInterceptors() grpc.ServerOption {
+	return grpc.ChainStreamInterceptor(streamRecovery, streamRequestID, streamLogging, streamAuth)
+}
+
+func recoverPanic(method string, err *error) {
+	if r := recover(); r != nil {
+		logger.Error("gRPC panic",
+			zap.String("method", method),
+			zap.Any("panic", r),
+			zap.ByteString("stack", debug.Stack()),
+		)
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+func unaryRecovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func streamRecovery(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+// withRequestID reuses the caller's x-request-id or generates one, and echoes
+// it in the response headers.
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(requestIDHeader); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func unaryRequestID(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestID(ctx), req)
+}
+
+func streamRequestID(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+}
+
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	grpcRequests.WithLabelValues(method, code.String()).Inc()
+	grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("code", code.String()),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("request_id", RequestIDFromContext(ctx)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, zap.String("peer", p.Addr.String()))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	logger.Info("gRPC request", fields...)
+}
+
+func unaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func streamLogging(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logRPC(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// CertificateIdentity returns the identity of a client that presented a
+// verified certificate over mutual TLS: its first URI SAN (e.g. a SPIFFE ID),
+// else its first DNS SAN, else its common name.
+func CertificateIdentity(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := info.State.VerifiedChains[0][0]
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String(), true
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0], true
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName, true
+	}
+	return "", false
+}
+
+// authenticate resolves the caller from the x-api-key or authorization
+// metadata, falling back to a verified client certificate (role "service"),
+// and checks the permission required by method.
+func authenticate(ctx context.Context, method string) (context.Context, error) {
+	if grpcPublicMethods[method] {
+		return ctx, nil
+	}
+	perm, ok := grpcMethodPermissions[method]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "method not allowed")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var principal *services.Principal
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		if p, ok := services.LookupAPIKey(keys[0]); ok {
+			principal = p
+		}
+	}
+	if auth := md.Get("authorization"); principal == nil && len(auth) > 0 && strings.HasPrefix(auth[0], "Bearer ") {
+		p, err := services.ParseAccessToken(strings.TrimPrefix(auth[0], "Bearer "))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		principal = p
+	}
+	if principal == nil {
+		identity, ok := CertificateIdentity(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing credentials")
+		}
+		principal = &services.Principal{Name: identity, Role: "service"}
+	}
+
+	if !HasPermission(principal.Role, perm) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %q lacks %s", principal.Role, perm)
+	}
+	return services.ContextWithPrincipal(ctx, principal), nil
+}
+
+func unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+}
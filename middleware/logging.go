@@ -2,24 +2,43 @@ package middleware
 
 import (
 	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"go.uber.org/zap"
 )
 
 var logger, _ = zap.NewProduction()
 
+// Logging writes every request to zap and queues it for storage in the
+// request_logs table. Only the path is recorded, never the query string,
+// which may carry tokens. Queued strings are copied: Fiber's point into
+// buffers that are reused once the request is done.
 func Logging() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
 		err := c.Next()
+		duration := time.Since(start)
+		userID, _ := c.Locals("user_id").(int)
 		logger.Info("Request",
 			zap.String("method", c.Method()),
 			zap.String("path", c.Path()),
 			zap.Int("status", c.Response().StatusCode()),
-			zap.Duration("duration", time.Since(start)),
-			zap.Any("userID", c.Locals("userID")),
+			zap.Duration("duration", duration),
+			zap.Int("userID", userID),
 		)
+		services.LogRequest(models.RequestLog{
+			Time:       start.UTC(),
+			Method:     utils.CopyString(c.Method()),
+			Path:       utils.CopyString(c.Path()),
+			Status:     c.Response().StatusCode(),
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			UserID:     userID,
+			IP:         utils.CopyString(c.IP()),
+			UserAgent:  utils.CopyString(c.Get(fiber.HeaderUserAgent)),
+		})
 		return err
 	}
 }
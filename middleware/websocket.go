@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WSSubprotocol is the subprotocol the server selects. Browsers sending a
+// ticket in Sec-WebSocket-Protocol offer it alongside "ticket.<ticket>".
+const WSSubprotocol = "notify.v1"
+
+const wsTicketProtocolPrefix = "ticket."
+
+// WSAuth authenticates WebSocket upgrades and event streams, which browsers
+// cannot send an Authorization header with. It accepts a single-use ticket
+// from POST /ws/ticket, as ?ticket= or a "ticket.<ticket>" subprotocol, and
+// the headers JWTAuth accepts. Full JWTs are never taken from the URL, where
+// they would end up in access logs. Cross-origin upgrades are refused unless
+// their origin is listed in WS_ALLOWED_ORIGINS, and requests without an
+// Origin header must be non-browser clients sending header credentials.
+func WSAuth() fiber.Handler {
+	allowed := AllowedOrigins(os.Getenv("WS_ALLOWED_ORIGINS"))
+	jwtAuth := JWTAuth()
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if (origin == "" && !hasHeaderCredentials(c)) || (origin != "" && !CheckOrigin(origin, c.Hostname(), allowed)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Origin not allowed"})
+		}
+
+		if ticket := wsTicket(c); ticket != "" {
+			rdb := services.InitRedis()
+			if rdb == nil {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Tickets unavailable"})
+			}
+			p, err := services.ConsumeWSTicket(c.Context(), rdb, ticket)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired ticket"})
+			}
+			c.Locals("user_id", p.UserID)
+			c.Locals("role", p.Role)
+			return c.Next()
+		}
+		return jwtAuth(c)
+	}
+}
+
+// hasHeaderCredentials reports whether the request carries the credentials
+// JWTAuth reads, which browsers cannot attach to WebSocket upgrades
+func hasHeaderCredentials(c *fiber.Ctx) bool {
+	return c.Get(fiber.HeaderAuthorization) != "" || c.Get("X-API-Key") != ""
+}
+
+// wsTicket returns the ticket from the query or the offered subprotocols
+func wsTicket(c *fiber.Ctx) string {
+	if ticket := c.Query("ticket"); ticket != "" {
+		return ticket
+	}
+	for _, proto := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		if proto = strings.TrimSpace(proto); strings.HasPrefix(proto, wsTicketProtocolPrefix) {
+			return strings.TrimPrefix(proto, wsTicketProtocolPrefix)
+		}
+	}
+	return ""
+}
+
+// AllowedOrigins parses a comma-separated list of origins such as
+// "https://app.example.com"; "*" allows any origin.
+func AllowedOrigins(list string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowed[strings.ToLower(origin)] = true
+		}
+	}
+	return allowed
+}
+
+// CheckOrigin allows same-origin requests and the allowed origins. An empty
+// origin is refused; WSAuth admits requests without one only when they
+// authenticate with a header.
+func CheckOrigin(origin, host string, allowed map[string]bool) bool {
+	if origin == "" {
+		return false
+	}
+	if allowed["*"] || allowed[strings.ToLower(origin)] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
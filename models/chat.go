@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Chat frame types. Clients send join, leave, message, typing and presence;
+// the server replies with ack or error and relays message, typing, join,
+// leave and presence.
+const (
+	ChatJoin     = "join"
+	ChatLeave    = "leave"
+	ChatMessage  = "message"
+	ChatTyping   = "typing"
+	ChatPresence = "presence"
+	ChatAck      = "ack"
+	ChatError    = "error"
+)
+
+// Room member roles
+const (
+	RoomOwner  = "owner"
+	RoomMember = "member"
+)
+
+// ChatFrame is one chat message over the WebSocket, in either direction.
+// A frame goes to Room, or to user To as a direct message. Clients may set ID
+// to their own reference, which the ack or error reply echoes in Ref; relayed
+// messages carry the server-assigned ID, which increases with every message.
+type ChatFrame struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id,omitempty"`
+	Ref     string    `json:"ref,omitempty"`
+	Room    string    `json:"room,omitempty"`
+	From    int       `json:"from,omitempty"`
+	To      int       `json:"to,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Status  string    `json:"status,omitempty"` // presence frames
+	SentAt  time.Time `json:"sent_at"`
+
+	// LastSeen on a join is the last message ID the client received; the
+	// room's later messages are replayed before live ones.
+	LastSeen string `json:"last_seen,omitempty"`
+}
+
+// ChatRoom is a named room. Anyone may join a public room; a private room
+// only admits its members.
+type ChatRoom struct {
+	Name      string    `json:"name"`
+	Private   bool      `json:"private"`
+	CreatedBy int       `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatRoomMember is a user's membership of a room
+type ChatRoomMember struct {
+	UserID   int       `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
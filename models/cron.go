@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Cron run states
+const (
+	CronRunning   = "running"
+	CronSucceeded = "succeeded"
+	CronFailed    = "failed"
+)
+
+// CronRun is one run of a cron job, for the tick it was scheduled at.
+// Instance is the replica that ran it.
+type CronRun struct {
+	ID          int64      `json:"id"`
+	Job         string     `json:"job"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Instance    string     `json:"instance"`
+}
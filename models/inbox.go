@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// InboxItem is an in-app notification kept in the user's inbox until it
+// expires
+type InboxItem struct {
+	ID             int64      `json:"id"`
+	NotificationID int64      `json:"notification_id,omitempty"`
+	Category       string     `json:"category"`
+	Priority       string     `json:"priority,omitempty"`
+	Subject        string     `json:"subject"`
+	Message        string     `json:"message"`
+	Read           bool       `json:"read"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+}
+
+// UnreadCount is the badge count pushed to the user's connections
+type UnreadCount struct {
+	Unread int `json:"unread"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job is a unit of background work in the Redis job queue. Payload is the
+// JSON payload of the job's type.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	EnqueuedAt  time.Time       `json:"enqueued_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`  // start of the latest attempt
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"` // when it completed or failed for good
+}
+
+// Job states, as listed by the admin API
+const (
+	JobQueued    = "queued"    // waiting for a worker
+	JobRetrying  = "retrying"  // failed, waiting for its next attempt
+	JobRunning   = "running"   // taken by a worker
+	JobPaused    = "paused"    // set aside while its type is paused
+	JobFailed    = "failed"    // out of attempts or failed permanently
+	JobCompleted = "completed" // finished successfully
+)
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Room sanctions. Muted users can read a room but not post to it; banned
+// users are removed from it and cannot join again.
+const (
+	SanctionMute = "mute"
+	SanctionBan  = "ban"
+)
+
+// RoomSanction mutes or bans a user in a room, until ExpiresAt when set
+type RoomSanction struct {
+	Room      string     `json:"room"`
+	UserID    int        `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Chat report states
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// ChatReport is a user's report of a chat message, kept for review. The
+// message is copied so the report outlives it.
+type ChatReport struct {
+	ID         int64      `json:"id"`
+	MessageID  int64      `json:"message_id"`
+	Room       string     `json:"room,omitempty"`
+	SenderID   int        `json:"sender_id"`
+	Message    string     `json:"message"`
+	ReporterID int        `json:"reporter_id"`
+	Reason     string     `json:"reason,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedBy int        `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Notification statuses
+const (
+	NotificationScheduled = "scheduled"
+	NotificationQueued    = "queued"
+	NotificationSent      = "sent"
+	NotificationFailed    = "failed"
+	NotificationCancelled = "cancelled"
+	// NotificationSuppressed means the user's preferences blocked delivery
+	NotificationSuppressed = "suppressed"
+	// NotificationDigest means the notification waits for the user's next digest
+	NotificationDigest = "digest"
+)
+
+// Notification priorities; only high priority skips the digest
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+type Notification struct {
+	ID             int64     `json:"id"`
+	UserID         int       `json:"user_id,omitempty"`
+	Email          string    `json:"email"`
+	Category       string    `json:"category"`
+	Priority       string    `json:"priority"`
+	Subject        string    `json:"subject"`
+	Message        string    `json:"message"`
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+	Status         string    `json:"status"`
+	SendAt         time.Time `json:"send_at"`
+	Error          string    `json:"error,omitempty"`
+	CreatedBy      int       `json:"created_by,omitempty"`
+	// CreatedByName is the API key or certificate that created it; empty for users
+	CreatedByName string    `json:"created_by_name,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// IsFinal reports whether the status can no longer change
+func (n *Notification) IsFinal() bool {
+	switch n.Status {
+	case NotificationSent, NotificationFailed, NotificationCancelled, NotificationSuppressed:
+		return true
+	}
+	return false
+}
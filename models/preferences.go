@@ -0,0 +1,45 @@
+package models
+
+// Notification categories
+const (
+	CategorySecurity  = "security"
+	CategoryAccount   = "account"
+	CategoryMarketing = "marketing"
+	CategoryGeneral   = "general"
+)
+
+// Notification channels
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "in_app" // pushed to the user's open WebSocket connections
+)
+
+// ChannelPreference turns one category on or off for one channel
+type ChannelPreference struct {
+	Category string `json:"category"`
+	Channel  string `json:"channel"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// QuietHours is a daily window, in the user's timezone, during which
+// non-critical notifications are deferred. Start and End are "HH:MM";
+// a window with Start after End wraps past midnight.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// Digest frequencies
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+type NotificationPreferences struct {
+	Channels   []ChannelPreference `json:"channels"`
+	QuietHours *QuietHours         `json:"quiet_hours,omitempty"`
+	// DigestFrequency batches non-urgent notifications into one email
+	DigestFrequency string `json:"digest_frequency"`
+}
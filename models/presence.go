@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Presence statuses. A user is online while any connection is active, away
+// when every connection is away, and offline without connections.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+type Presence struct {
+	UserID   int        `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RequestLog is one HTTP request as recorded by the logging middleware
+type RequestLog struct {
+	ID         int64     `json:"id,omitempty"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	UserID     int       `json:"user_id,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
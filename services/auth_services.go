@@ -39,6 +39,9 @@ var (
 type DBInterface interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
 	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
 	Close()
 }
 
@@ -98,6 +101,15 @@ func InitDB() func() DBInterface { // Runtime initialization
 		}
 	}
 
+	if err := migrate(pool); err != nil {
+		log.Printf("Failed to apply schema: %v", err)
+		pool.Close()
+		return func() DBInterface {
+			log.Println("DB not initialized due to schema error")
+			return nil
+		}
+	}
+
 	log.Printf("Initialized DB at %s, rows affected: %d", connString, cmdTag.RowsAffected())
 	db = pool
 	return func() DBInterface { return db }
@@ -189,6 +201,10 @@ func InitDBTest() {
 		}
 	}
 
+	if err := migrate(db); err != nil {
+		log.Fatalf("Failed to apply schema: %v", err)
+	}
+
 	_, err = db.Exec(context.Background(), "TRUNCATE TABLE users RESTART IDENTITY")
 	if err != nil {
 		log.Fatalf("Failed to truncate table: %v", err)
@@ -204,6 +220,10 @@ func JWTSecret() []byte {
 	return jwtSecret
 }
 
+// DefaultRole is the role of every new account
+const DefaultRole = "user"
+
+// Register creates an account with DefaultRole; user.Role is ignored
 func Register(user models.User) (string, error) {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -220,7 +240,7 @@ func Register(user models.User) (string, error) {
 	}
 	_, err = db.Exec(context.Background(), `
 		INSERT INTO users (email, password, role, totp_secret) VALUES ($1, $2, $3, $4)
-	`, user.Email, hashed, user.Role, key.Secret())
+	`, user.Email, hashed, DefaultRole, key.Secret())
 	if err != nil {
 		log.Printf("DB insert error: %v", err)
 		return "", fmt.Errorf("DB insert error: %v", err)
@@ -412,6 +432,26 @@ func Verify2FA(tokenString, totpCode string) (string, error) {
 	return fullTokenString, nil
 }
 
+// LoginEvent is the data of a "welcome_back" WebSocket event, sent to the
+// user's open connections when they complete a login elsewhere
+type LoginEvent struct {
+	Message   string    `json:"message"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// NotifyLogin tells userID's open connections, on every instance, about a
+// completed login
+func NotifyLogin(userID int, ip, userAgent string) {
+	Notify(userID, Event{Type: EventWelcomeBack, Data: LoginEvent{
+		Message:   "Welcome back!",
+		IP:        ip,
+		UserAgent: userAgent,
+		At:        time.Now().UTC(),
+	}})
+}
+
 func generateToken(userID int, role string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"id":   userID,
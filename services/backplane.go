@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// BackplaneChannel is the Redis pub/sub channel shared by all instances
+const BackplaneChannel = "ws:events"
+
+const backplanePublishTimeout = 2 * time.Second
+
+var (
+	// backplane is set once StartWSBackplane has subscribed; until then, and
+	// without Redis, messages only reach connections on this instance.
+	backplane atomic.Pointer[Backplane]
+
+	backplaneMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_backplane_messages_total",
+			Help: "WebSocket messages relayed through Redis by direction and result",
+		},
+		[]string{"direction", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(backplaneMessages)
+}
+
+// wsEnvelope is what instances publish to each other
+type wsEnvelope struct {
+	Origin      string          `json:"origin"`
+	UserID      int             `json:"user_id,omitempty"` // 0 for broadcasts
+	Room        string          `json:"room,omitempty"`
+	Unsubscribe bool            `json:"unsubscribe,omitempty"` // remove UserID from Room
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// Backplane relays hub messages between instances over Redis pub/sub so a
+// user is reached whichever instance holds their connections. Each message is
+// delivered locally right away and published for the other instances, which
+// skip messages they published themselves.
+type Backplane struct {
+	hub    *Hub
+	rdb    *redis.Client
+	origin string
+}
+
+func NewBackplane(hub *Hub, rdb *redis.Client) *Backplane {
+	return &Backplane{hub: hub, rdb: rdb, origin: uuid.NewString()}
+}
+
+// Notify sends v to userID's connections on every instance and returns the
+// number of local connections that received it.
+func (b *Backplane) Notify(userID int, v interface{}) int {
+	b.publish(wsEnvelope{UserID: userID}, v)
+	return b.hub.Notify(userID, v)
+}
+
+// Broadcast sends v to every connection on every instance
+func (b *Backplane) Broadcast(v interface{}) int {
+	b.publish(wsEnvelope{}, v)
+	return b.hub.Broadcast(v)
+}
+
+// PublishRoom sends v to the connections subscribed to room on every instance
+func (b *Backplane) PublishRoom(room string, v interface{}) int {
+	b.publish(wsEnvelope{Room: room}, v)
+	return b.hub.PublishRoom(room, v)
+}
+
+// RemoveFromRoom unsubscribes userID's connections from room on every instance
+func (b *Backplane) RemoveFromRoom(room string, userID int) int {
+	b.publish(wsEnvelope{UserID: userID, Room: room, Unsubscribe: true}, nil)
+	return b.hub.RemoveFromRoom(room, userID)
+}
+
+func (b *Backplane) publish(env wsEnvelope, v interface{}) {
+	if v != nil {
+		payload, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("Backplane: failed to encode message: %v", err)
+			return
+		}
+		env.Payload = payload
+	}
+	env.Origin = b.origin
+	data, _ := json.Marshal(env)
+
+	ctx, cancel := context.WithTimeout(context.Background(), backplanePublishTimeout)
+	defer cancel()
+	if err := b.rdb.Publish(ctx, BackplaneChannel, data).Err(); err != nil {
+		backplaneMessages.WithLabelValues("published", "error").Inc()
+		log.Printf("Backplane: failed to publish, delivered locally only: %v", err)
+		return
+	}
+	backplaneMessages.WithLabelValues("published", "ok").Inc()
+}
+
+// Run delivers messages published by other instances until ctx is cancelled.
+// go-redis resubscribes automatically after connection errors.
+func (b *Backplane) Run(ctx context.Context) error {
+	pubsub := b.rdb.Subscribe(ctx, BackplaneChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			b.deliver(msg.Payload)
+		}
+	}
+}
+
+func (b *Backplane) deliver(data string) {
+	var env wsEnvelope
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		backplaneMessages.WithLabelValues("received", "invalid").Inc()
+		log.Printf("Backplane: dropping invalid message: %v", err)
+		return
+	}
+	if env.Origin == b.origin {
+		return
+	}
+	backplaneMessages.WithLabelValues("received", "ok").Inc()
+	switch {
+	case env.Unsubscribe:
+		b.hub.RemoveFromRoom(env.Room, env.UserID)
+	case env.Room != "":
+		b.hub.PublishRoom(env.Room, env.Payload)
+	case env.UserID == 0:
+		b.hub.Broadcast(env.Payload)
+	case b.hub.Connections(env.UserID) > 0:
+		b.hub.Notify(env.UserID, env.Payload)
+	}
+}
+
+// StartWSBackplane connects the default hub to the other instances. Without
+// Redis the service keeps working with local-only delivery.
+func StartWSBackplane(ctx context.Context) {
+	rdb := InitRedis()
+	if rdb == nil {
+		log.Println("Redis not available; WebSocket messages reach this instance only")
+		return
+	}
+	b := NewBackplane(hub, rdb)
+	backplane.Store(b)
+	defer backplane.Store(nil)
+
+	log.Println("WebSocket backplane subscribed to Redis channel " + BackplaneChannel)
+	if err := b.Run(ctx); err != nil {
+		log.Printf("WebSocket backplane stopped: %v", err)
+	}
+}
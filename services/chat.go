@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GlobalRoom is the public room created with the schema
+const GlobalRoom = "global"
+
+var (
+	ErrRoomNotFound    = errors.New("room not found")
+	ErrRoomExists      = errors.New("room already exists")
+	ErrRoomForbidden   = errors.New("not allowed in this room")
+	ErrInvalidRoomName = errors.New("room names are 1-64 lowercase letters, digits, '-' or '_'")
+	ErrNotInRoom       = errors.New("not in this room")
+)
+
+var roomNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateRoomName checks a room name
+func ValidateRoomName(name string) error {
+	if !roomNamePattern.MatchString(name) {
+		return ErrInvalidRoomName
+	}
+	return nil
+}
+
+// AuthorizeRoomJoin decides whether a user with the given role may join room.
+// Admins may join any room, members their rooms, and everyone public rooms.
+func AuthorizeRoomJoin(room *models.ChatRoom, role string, member bool) error {
+	if role == "admin" || !room.Private || member {
+		return nil
+	}
+	return ErrRoomForbidden
+}
+
+// CanManageRoom reports whether a user may add or remove members: admins and
+// the room's owners can.
+func CanManageRoom(role, memberRole string) bool {
+	return role == "admin" || memberRole == models.RoomOwner
+}
+
+// CreateRoom stores a room with createdBy as its owner
+func CreateRoom(ctx context.Context, name string, private bool, createdBy int) (*models.ChatRoom, error) {
+	if err := ValidateRoomName(name); err != nil {
+		return nil, err
+	}
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	tx, err := DB().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	room := &models.ChatRoom{Name: name, Private: private, CreatedBy: createdBy}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO chat_rooms (name, private, created_by) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING created_at`, name, private, createdBy).Scan(&room.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrRoomExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO chat_room_members (room, user_id, role) VALUES ($1, $2, $3)",
+		name, createdBy, models.RoomOwner); err != nil {
+		return nil, err
+	}
+	return room, tx.Commit(ctx)
+}
+
+// GetRoom loads a room by name
+func GetRoom(ctx context.Context, name string) (*models.ChatRoom, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	var room models.ChatRoom
+	err := DB().QueryRow(ctx,
+		"SELECT name, private, COALESCE(created_by, 0), created_at FROM chat_rooms WHERE name = $1", name,
+	).Scan(&room.Name, &room.Private, &room.CreatedBy, &room.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// ListRooms returns the public rooms and the private rooms userID belongs to
+func ListRooms(ctx context.Context, userID int) ([]models.ChatRoom, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT name, private, COALESCE(created_by, 0), created_at FROM chat_rooms r
+		WHERE NOT private OR EXISTS (SELECT 1 FROM chat_room_members m WHERE m.room = r.name AND m.user_id = $1)
+		ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := []models.ChatRoom{}
+	for rows.Next() {
+		var room models.ChatRoom
+		if err := rows.Scan(&room.Name, &room.Private, &room.CreatedBy, &room.CreatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// UserRooms returns the names of the rooms userID is a member of
+func UserRooms(ctx context.Context, userID int) ([]string, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT room FROM chat_room_members WHERE user_id = $1 ORDER BY room", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rooms []string
+	for rows.Next() {
+		var room string
+		if err := rows.Scan(&room); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// RoomMemberRole returns userID's role in room, or "" if they are not a member
+func RoomMemberRole(ctx context.Context, room string, userID int) (string, error) {
+	if DB() == nil {
+		return "", errors.New("database not available")
+	}
+	var role string
+	err := DB().QueryRow(ctx,
+		"SELECT role FROM chat_room_members WHERE room = $1 AND user_id = $2", room, userID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// AddRoomMember adds userID to room; existing members keep their role
+func AddRoomMember(ctx context.Context, room string, userID int, role string) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	_, err := DB().Exec(ctx, `
+		INSERT INTO chat_room_members (room, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (room, user_id) DO NOTHING`, room, userID, role)
+	return err
+}
+
+// RemoveRoomMember deletes userID's membership and unsubscribes their open
+// connections from the room on every instance.
+func RemoveRoomMember(ctx context.Context, room string, userID int) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	if _, err := DB().Exec(ctx,
+		"DELETE FROM chat_room_members WHERE room = $1 AND user_id = $2", room, userID); err != nil {
+		return err
+	}
+	RemoveFromRoom(room, userID)
+	return nil
+}
+
+// JoinRoom authorizes the client's user for room and subscribes the
+// connection to it. Joining a public room makes the user a member. With
+// lastSeen set, the room's messages after that ID are replayed to the
+// connection before any live ones.
+func JoinRoom(ctx context.Context, c *WSClient, role, name string, lastSeen int64) error {
+	room, err := GetRoom(ctx, name)
+	if err != nil {
+		return err
+	}
+	memberRole, err := RoomMemberRole(ctx, name, c.UserID)
+	if err != nil {
+		return err
+	}
+	if err := AuthorizeRoomJoin(room, role, memberRole != ""); err != nil {
+		return err
+	}
+	if role != "admin" {
+		// Muted users may still join and read
+		if err := CheckSanctions(ctx, name, c.UserID); err != nil && !errors.Is(err, ErrMuted) {
+			return err
+		}
+	}
+	if memberRole == "" && !room.Private {
+		if err := AddRoomMember(ctx, name, c.UserID, models.RoomMember); err != nil {
+			return err
+		}
+	}
+	if lastSeen > 0 {
+		return c.hub.JoinReplay(c, name, func() ([]models.ChatFrame, error) {
+			return RoomMessagesSince(context.Background(), name, lastSeen, ChatReplayLimit)
+		})
+	}
+	if !c.hub.Join(c, name) {
+		return ErrClientClosed
+	}
+	return nil
+}
+
+// RejectChatFrame reports to the sending connection why f was not carried out
+func RejectChatFrame(c *WSClient, f *models.ChatFrame, err error) {
+	c.Send(models.ChatFrame{Type: models.ChatError, Ref: f.ID, Room: f.Room, Error: err.Error(), SentAt: time.Now().UTC()})
+}
+
+// HandleChatFrame carries out one frame received from a client. Joins, leaves
+// and messages are acknowledged, messages with their server-assigned ID;
+// failures are reported to the sending connection as error frames.
+func HandleChatFrame(ctx context.Context, c *WSClient, role string, f *models.ChatFrame) {
+	now := time.Now().UTC()
+	reply := func(err error, id string) {
+		if err != nil {
+			RejectChatFrame(c, f, err)
+		} else {
+			c.Send(models.ChatFrame{Type: models.ChatAck, ID: id, Ref: f.ID, Room: f.Room, To: f.To, SentAt: now})
+		}
+	}
+
+	switch f.Type {
+	case models.ChatJoin:
+		var lastSeen int64
+		if f.LastSeen != "" {
+			id, err := strconv.ParseInt(f.LastSeen, 10, 64)
+			if err != nil || id < 0 {
+				reply(errors.New("invalid last_seen"), "")
+				return
+			}
+			lastSeen = id
+		}
+		if err := JoinRoom(ctx, c, role, f.Room, lastSeen); err != nil {
+			if !errors.Is(err, ErrRoomNotFound) && !errors.Is(err, ErrRoomForbidden) && !errors.Is(err, ErrBanned) {
+				log.Printf("User %d failed to join room %q: %v", c.UserID, f.Room, err)
+				err = errors.New("failed to join room")
+			}
+			reply(err, "")
+			return
+		}
+		PublishRoom(f.Room, models.ChatFrame{Type: models.ChatJoin, Room: f.Room, From: c.UserID, SentAt: now})
+		reply(nil, "")
+
+	case models.ChatLeave:
+		if !c.hub.Leave(c, f.Room) {
+			reply(ErrNotInRoom, "")
+			return
+		}
+		PublishRoom(f.Room, models.ChatFrame{Type: models.ChatLeave, Room: f.Room, From: c.UserID, SentAt: now})
+		reply(nil, "")
+
+	case models.ChatMessage, models.ChatTyping:
+		switch {
+		case f.Room != "" && f.To != 0:
+			reply(errors.New("set either room or to, not both"), "")
+			return
+		case f.Room != "":
+			if !c.hub.InRoom(c, f.Room) {
+				reply(ErrNotInRoom, "")
+				return
+			}
+		case f.To <= 0:
+			reply(errors.New("room or to is required"), "")
+			return
+		}
+
+		out := models.ChatFrame{Type: f.Type, Room: f.Room, From: c.UserID, To: f.To, SentAt: now}
+		if f.Type == models.ChatMessage {
+			message, err := CheckChatMessage(f.Message)
+			if err != nil {
+				reply(err, "")
+				return
+			}
+			if f.Room != "" {
+				if err := CheckSanctions(ctx, f.Room, c.UserID); err != nil {
+					if !errors.Is(err, ErrMuted) && !errors.Is(err, ErrBanned) {
+						log.Printf("Failed to check sanctions of user %d in room %q: %v", c.UserID, f.Room, err)
+						err = errors.New("failed to send message")
+					}
+					reply(err, "")
+					return
+				}
+			}
+			out.Message = message
+			// Stored before delivery so the ID can be used to catch up later
+			if err := SaveChatMessage(ctx, &out); err != nil {
+				log.Printf("Failed to store chat message from user %d: %v", c.UserID, err)
+				reply(errors.New("failed to send message"), "")
+				return
+			}
+		}
+		if f.Room != "" {
+			PublishRoom(f.Room, out)
+		} else {
+			// The sender's other devices get a copy of their direct messages
+			Notify(f.To, out)
+			if f.To != c.UserID {
+				Notify(c.UserID, out)
+			}
+		}
+		if f.Type == models.ChatMessage {
+			reply(nil, out.ID)
+		}
+
+	case models.ChatPresence:
+		if f.Status != models.PresenceOnline && f.Status != models.PresenceAway {
+			reply(errors.New("status must be online or away"), "")
+			return
+		}
+		if err := PresenceSetAway(c, f.Status == models.PresenceAway); err != nil {
+			log.Printf("Presence: failed to update user %d: %v", c.UserID, err)
+			reply(errors.New("failed to update presence"), "")
+			return
+		}
+		reply(nil, "")
+
+	default:
+		reply(errors.New("unknown frame type "+f.Type), "")
+	}
+}
+
+// Join subscribes c to room. It returns false once c has been unregistered.
+func (h *Hub) Join(c *WSClient, room string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.users[c.UserID][c]; !ok {
+		return false
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*WSClient]struct{})
+	}
+	h.rooms[room][c] = struct{}{}
+	c.rooms[room] = struct{}{}
+	return true
+}
+
+// Leave unsubscribes c from room and reports whether it was subscribed
+func (h *Hub) Leave(c *WSClient, room string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.leave(c, room)
+}
+
+// leave requires h.mu to be held
+func (h *Hub) leave(c *WSClient, room string) bool {
+	if _, ok := c.rooms[room]; !ok {
+		return false
+	}
+	delete(c.rooms, room)
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+	return true
+}
+
+// InRoom reports whether c is subscribed to room
+func (h *Hub) InRoom(c *WSClient, room string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := c.rooms[room]
+	return ok
+}
+
+// PublishRoom queues v for every connection subscribed to room
+func (h *Hub) PublishRoom(room string, v interface{}) int {
+	h.mu.RLock()
+	targets := make([]*WSClient, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	return h.send(targets, v)
+}
+
+// RemoveFromRoom unsubscribes all of userID's connections from room and
+// returns how many were subscribed
+func (h *Hub) RemoveFromRoom(room string, userID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	removed := 0
+	for c := range h.users[userID] {
+		if h.leave(c, room) {
+			removed++
+		}
+	}
+	return removed
+}
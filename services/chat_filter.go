@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Chat limits. MaxChatFrameSize bounds a frame read from a WebSocket, in
+// bytes; connections sending larger frames are closed. Each connection may
+// send ChatRateLimit frames per second on average, in bursts of up to
+// ChatRateBurst.
+const (
+	MaxChatFrameSize     = 8 << 10
+	MaxChatMessageLength = 2000 // characters
+	ChatRateLimit        = 5
+	ChatRateBurst        = 10
+)
+
+var (
+	ErrMessageEmpty    = errors.New("message is empty")
+	ErrMessageTooLong  = errors.New("message is longer than 2000 characters")
+	ErrRateLimited     = errors.New("sending too fast")
+	ErrLinksNotAllowed = errors.New("links are not allowed")
+)
+
+// TokenBucket is a rate limiter holding up to burst tokens, refilled at rate
+// per second; each allowed event takes one. It is not safe for concurrent
+// use: each connection's reader owns its own.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Allow takes a token if one is available
+func (b *TokenBucket) Allow() bool {
+	return b.AllowAt(time.Now())
+}
+
+// AllowAt is Allow at the given time
+func (b *TokenBucket) AllowAt(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ChatFilter inspects a chat message before it is stored. It returns the
+// message to send, possibly rewritten, or an error to reject it; the error
+// text is shown to the sender.
+type ChatFilter func(message string) (string, error)
+
+var (
+	chatFiltersMu sync.RWMutex
+	chatFilters   []ChatFilter
+)
+
+// SetChatFilters replaces the filters every chat message passes through, in order
+func SetChatFilters(filters ...ChatFilter) {
+	chatFiltersMu.Lock()
+	defer chatFiltersMu.Unlock()
+	chatFilters = filters
+}
+
+// CheckChatMessage applies the length limit and the chat filters to message
+func CheckChatMessage(message string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", ErrMessageEmpty
+	}
+	if utf8.RuneCountInString(message) > MaxChatMessageLength {
+		return "", ErrMessageTooLong
+	}
+	chatFiltersMu.RLock()
+	filters := chatFilters
+	chatFiltersMu.RUnlock()
+	for _, filter := range filters {
+		var err error
+		if message, err = filter(message); err != nil {
+			return "", err
+		}
+	}
+	return message, nil
+}
+
+// WordFilter masks the given words, matched whole and ignoring case, with
+// asterisks
+func WordFilter(words []string) ChatFilter {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return func(message string) (string, error) { return message, nil }
+	}
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return func(message string) (string, error) {
+		return pattern.ReplaceAllStringFunc(message, func(w string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(w))
+		}), nil
+	}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// LinkFilter rejects messages containing links, except to the allowed
+// domains and their subdomains
+func LinkFilter(allowedDomains []string) ChatFilter {
+	allowed := make(map[string]bool)
+	for _, d := range allowedDomains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			allowed[d] = true
+		}
+	}
+	return func(message string) (string, error) {
+		for _, link := range linkPattern.FindAllString(message, -1) {
+			if !strings.Contains(link, "://") {
+				link = "http://" + link
+			}
+			u, err := url.Parse(link)
+			if err != nil || !domainAllowed(strings.ToLower(u.Hostname()), allowed) {
+				return "", ErrLinksNotAllowed
+			}
+		}
+		return message, nil
+	}
+}
+
+func domainAllowed(host string, allowed map[string]bool) bool {
+	for host != "" {
+		if allowed[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+// ChatFiltersFromEnv builds the filters configured by CHAT_BLOCKED_WORDS
+// (comma-separated), CHAT_BLOCK_LINKS=true and CHAT_ALLOWED_LINK_DOMAINS
+// (comma-separated domains still allowed when links are blocked).
+func ChatFiltersFromEnv() []ChatFilter {
+	var filters []ChatFilter
+	if words := os.Getenv("CHAT_BLOCKED_WORDS"); words != "" {
+		filters = append(filters, WordFilter(strings.Split(words, ",")))
+	}
+	if os.Getenv("CHAT_BLOCK_LINKS") == "true" {
+		filters = append(filters, LinkFilter(strings.Split(os.Getenv("CHAT_ALLOWED_LINK_DOMAINS"), ",")))
+	}
+	log.Printf("Chat content filters: %d configured", len(filters))
+	return filters
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ChatReplayLimit caps the missed messages replayed to a reconnecting
+// client; older ones can be paged in from the history endpoint.
+const ChatReplayLimit = 500
+
+const chatMessageColumns = `id, COALESCE(room, ''), sender_id, COALESCE(recipient_id, 0), message, created_at`
+
+// ReplayLoader returns missed messages, oldest first
+type ReplayLoader func() ([]models.ChatFrame, error)
+
+// replay is queued on a client ahead of a subscription. The writer waits for
+// ready, which is closed once live messages can reach the client, so nothing
+// falls between the loaded messages and the live ones.
+type replay struct {
+	load   func() ([]interface{}, error)
+	id     func(v interface{}) int64 // identifies live copies of replayed messages
+	failed func() interface{}        // written when load fails
+	ready  chan struct{}
+}
+
+func newReplay(load ReplayLoader) *replay {
+	return &replay{
+		load: func() ([]interface{}, error) {
+			frames, err := load()
+			out := make([]interface{}, len(frames))
+			for i, f := range frames {
+				out[i] = f
+			}
+			return out, err
+		},
+		id: chatMessageID,
+		failed: func() interface{} {
+			return models.ChatFrame{Type: models.ChatError, Error: "failed to load missed messages", SentAt: time.Now().UTC()}
+		},
+		ready: make(chan struct{}),
+	}
+}
+
+// replay writes the missed messages; it returns false if a write failed
+func (c *WSClient) replay(r *replay) bool {
+	select {
+	case <-r.ready:
+	case <-c.done:
+		return true
+	}
+	msgs, err := r.load()
+	if err != nil {
+		log.Printf("Failed to load missed messages for user %d: %v", c.UserID, err)
+		msgs = []interface{}{r.failed()}
+	}
+	c.replayedID = r.id
+	for _, v := range msgs {
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.WriteTimeout))
+		if err := c.conn.WriteJSON(v); err != nil {
+			log.Printf("Failed to replay messages to user %d: %v", c.UserID, err)
+			wsDropped.WithLabelValues("write_error").Inc()
+			return false
+		}
+		if id := r.id(v); id > c.replayedUpTo {
+			c.replayedUpTo = id
+		}
+	}
+	return true
+}
+
+// replayed reports whether v is a live copy of a message already replayed
+func (c *WSClient) replayed(v interface{}) bool {
+	if c.replayedUpTo == 0 {
+		return false
+	}
+	id := c.replayedID(v)
+	return id != 0 && id <= c.replayedUpTo
+}
+
+// chatMessageID returns the ID of a chat message frame, as queued locally or
+// relayed by the backplane, and 0 for anything else.
+func chatMessageID(v interface{}) int64 {
+	var f models.ChatFrame
+	switch m := v.(type) {
+	case models.ChatFrame:
+		f = m
+	case json.RawMessage:
+		if json.Unmarshal(m, &f) != nil {
+			return 0
+		}
+	default:
+		return 0
+	}
+	if f.Type != models.ChatMessage {
+		return 0
+	}
+	id, _ := strconv.ParseInt(f.ID, 10, 64)
+	return id
+}
+
+// JoinReplay subscribes c to room after queueing the messages returned by
+// load, so they reach the client before the room's live messages.
+func (h *Hub) JoinReplay(c *WSClient, room string, load ReplayLoader) error {
+	r := newReplay(load)
+	if err := c.Send(r); err != nil {
+		return err
+	}
+	defer close(r.ready)
+	if !h.Join(c, room) {
+		return ErrClientClosed
+	}
+	return nil
+}
+
+// SaveChatMessage stores a room or direct message and sets its ID and time
+func SaveChatMessage(ctx context.Context, f *models.ChatFrame) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	var id int64
+	err := DB().QueryRow(ctx, `
+		INSERT INTO chat_messages (room, sender_id, recipient_id, message)
+		VALUES (NULLIF($1, ''), $2, NULLIF($3, 0), $4)
+		RETURNING id, created_at`, f.Room, f.From, f.To, f.Message).Scan(&id, &f.SentAt)
+	if err != nil {
+		return err
+	}
+	f.ID = strconv.FormatInt(id, 10)
+	return nil
+}
+
+// PostGlobalChat stores a message from the original untyped chat in the
+// global room and broadcasts it in that chat's format. Messages rejected by
+// the chat filters, or from users muted in the global room, are not sent.
+func PostGlobalChat(ctx context.Context, userID int, message string) error {
+	if message != "" {
+		var err error
+		if message, err = CheckChatMessage(message); err != nil {
+			return err
+		}
+		if err := CheckSanctions(ctx, GlobalRoom, userID); errors.Is(err, ErrMuted) || errors.Is(err, ErrBanned) {
+			return err
+		}
+		f := models.ChatFrame{Room: GlobalRoom, From: userID, Message: message}
+		if err := SaveChatMessage(ctx, &f); err != nil {
+			log.Printf("Failed to store global chat message from user %d: %v", userID, err)
+		}
+	}
+	Broadcast(map[string]interface{}{
+		"user_id": userID,
+		"message": message,
+	})
+	return nil
+}
+
+// RoomMessages pages through a room's history. With after set it returns up
+// to limit messages following that ID, oldest first; otherwise the newest
+// messages before before (or the newest overall when it is 0), newest first.
+func RoomMessages(ctx context.Context, room string, before, after int64, limit int) ([]models.ChatFrame, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	query := "SELECT " + chatMessageColumns + " FROM chat_messages WHERE room = $1 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3"
+	cursor := before
+	if after > 0 {
+		query = "SELECT " + chatMessageColumns + " FROM chat_messages WHERE room = $1 AND id > $2 ORDER BY id LIMIT $3"
+		cursor = after
+	}
+	rows, err := DB().Query(ctx, query, room, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanChatMessages(rows)
+}
+
+// RoomMessagesSince returns the newest limit messages in room after the given
+// ID, oldest first.
+func RoomMessagesSince(ctx context.Context, room string, after int64, limit int) ([]models.ChatFrame, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT "+chatMessageColumns+`
+		FROM chat_messages WHERE room = $1 AND id > $2 ORDER BY id DESC LIMIT $3`, room, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return oldestFirst(scanChatMessages(rows))
+}
+
+// DirectMessagesSince returns the newest limit direct messages sent to or by
+// userID after the given ID, oldest first.
+func DirectMessagesSince(ctx context.Context, userID int, after int64, limit int) ([]models.ChatFrame, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT "+chatMessageColumns+`
+		FROM chat_messages
+		WHERE (recipient_id = $1 OR (sender_id = $1 AND recipient_id IS NOT NULL)) AND id > $2
+		ORDER BY id DESC LIMIT $3`, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return oldestFirst(scanChatMessages(rows))
+}
+
+func scanChatMessages(rows pgx.Rows) ([]models.ChatFrame, error) {
+	defer rows.Close()
+	messages := []models.ChatFrame{}
+	for rows.Next() {
+		f := models.ChatFrame{Type: models.ChatMessage}
+		var id int64
+		if err := rows.Scan(&id, &f.Room, &f.From, &f.To, &f.Message, &f.SentAt); err != nil {
+			return nil, err
+		}
+		f.ID = strconv.FormatInt(id, 10)
+		messages = append(messages, f)
+	}
+	return messages, rows.Err()
+}
+
+func oldestFirst(messages []models.ChatFrame, err error) ([]models.ChatFrame, error) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, err
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	cronLeaseTTL   = 15 * time.Second
+	cronLeaseRenew = 5 * time.Second
+	cronTick       = time.Second
+)
+
+var ErrCronJobExists = errors.New("cron job already registered")
+
+var cronRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cron_runs_total",
+		Help: "Cron job runs on this instance, by job and status",
+	},
+	[]string{"job", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(cronRuns)
+}
+
+// CronRunStore records cron runs. Start stores a run before it begins and
+// reports false, without storing anything, if the job already has a run for
+// that scheduled time; that check is what keeps a tick from running twice.
+type CronRunStore interface {
+	Start(ctx context.Context, run *models.CronRun) (bool, error)
+	Finish(ctx context.Context, run *models.CronRun) error
+}
+
+// Cron runs named jobs on cron schedules. Every instance runs a Cron with
+// the same jobs, but only the leader, the instance holding a lease in Redis,
+// starts them. Runs are recorded in the CronRunStore before they start, so a
+// tick runs at most once even while leadership changes hands; ticks missed
+// while there is no leader are skipped, not made up. Without Redis every
+// instance considers itself the leader and the store alone decides.
+type Cron struct {
+	rdb      *redis.Client
+	key      string
+	instance string
+	store    CronRunStore
+	wg       sync.WaitGroup
+	leader   atomic.Bool
+
+	mu   sync.Mutex
+	jobs map[string]*cronJob
+}
+
+type cronJob struct {
+	name     string
+	spec     string
+	schedule *CronSchedule
+	run      func(ctx context.Context) error
+	next     time.Time
+	running  bool
+}
+
+// CronJobInfo describes a registered job
+type CronJobInfo struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"next_run"`
+	Running  bool      `json:"running"`
+}
+
+// NewCron returns a scheduler that elects its leader with the lease at key;
+// rdb may be nil. instance names this instance in the lease and the runs.
+func NewCron(rdb *redis.Client, key, instance string, store CronRunStore) *Cron {
+	c := &Cron{rdb: rdb, key: key, instance: instance, store: store, jobs: make(map[string]*cronJob)}
+	c.leader.Store(rdb == nil)
+	return c
+}
+
+// Register adds a job run on the cron expression spec
+func (c *Cron) Register(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.jobs[name]; ok {
+		return ErrCronJobExists
+	}
+	c.jobs[name] = &cronJob{name: name, spec: spec, schedule: schedule, run: run, next: schedule.Next(time.Now())}
+	return nil
+}
+
+// Jobs lists the registered jobs by name
+func (c *Cron) Jobs() []CronJobInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := make([]CronJobInfo, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		jobs = append(jobs, CronJobInfo{Name: j.name, Schedule: j.spec, NextRun: j.next, Running: j.running})
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Name < jobs[b].Name })
+	return jobs
+}
+
+// Instance names this instance
+func (c *Cron) Instance() string {
+	return c.instance
+}
+
+// IsLeader reports whether this instance starts the jobs
+func (c *Cron) IsLeader() bool {
+	return c.leader.Load()
+}
+
+var (
+	// KEYS: lease; ARGV: instance, ttl in ms. Takes the lease if it is free
+	// and extends it if this instance holds it.
+	cronCampaignScript = redis.NewScript(`
+		if redis.call('GET', KEYS[1]) == ARGV[1] then
+			redis.call('PEXPIRE', KEYS[1], ARGV[2])
+			return 1
+		end
+		if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then return 1 end
+		return 0`)
+	// KEYS: lease; ARGV: instance
+	cronResignScript = redis.NewScript(`
+		if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+		return 0`)
+)
+
+// Campaign takes or renews the leader lease and reports whether this
+// instance is the leader. An instance that cannot reach Redis steps down.
+func (c *Cron) Campaign(ctx context.Context) (bool, error) {
+	if c.rdb == nil {
+		return true, nil
+	}
+	n, err := cronCampaignScript.Run(ctx, c.rdb, []string{c.key}, c.instance, cronLeaseTTL.Milliseconds()).Int()
+	leader := err == nil && n == 1
+	if was := c.leader.Swap(leader); was != leader {
+		if leader {
+			log.Printf("Cron: %s is now the leader", c.instance)
+		} else {
+			log.Printf("Cron: %s is no longer the leader", c.instance)
+		}
+	}
+	return leader, err
+}
+
+// Resign gives up the lease, if held, so another instance takes over
+// without waiting for it to expire
+func (c *Cron) Resign(ctx context.Context) error {
+	if c.rdb == nil {
+		return nil
+	}
+	c.leader.Store(false)
+	return cronResignScript.Run(ctx, c.rdb, []string{c.key}, c.instance).Err()
+}
+
+// Tick starts the jobs due at now, if this instance is the leader. A job
+// still running from an earlier tick is not started again. Run calls it
+// every second.
+func (c *Cron) Tick(ctx context.Context, now time.Time) {
+	leader := c.IsLeader()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, j := range c.jobs {
+		if j.next.After(now) {
+			continue
+		}
+		scheduled := j.next
+		j.next = j.schedule.Next(now)
+		if !leader {
+			continue
+		}
+		if j.running {
+			log.Printf("Cron job %s: skipping the %s run, the previous run has not finished", j.name, scheduled.Format(time.RFC3339))
+			continue
+		}
+		j.running = true
+		c.wg.Add(1)
+		go c.run(ctx, j, scheduled)
+	}
+}
+
+func (c *Cron) run(ctx context.Context, j *cronJob, scheduled time.Time) {
+	defer c.wg.Done()
+	defer func() {
+		c.mu.Lock()
+		j.running = false
+		c.mu.Unlock()
+	}()
+
+	run := &models.CronRun{
+		Job:         j.name,
+		ScheduledAt: scheduled,
+		StartedAt:   time.Now().UTC(),
+		Status:      models.CronRunning,
+		Instance:    c.instance,
+	}
+	ok, err := c.store.Start(ctx, run)
+	if err != nil {
+		log.Printf("Cron job %s: failed to record run: %v", j.name, err)
+		return
+	}
+	if !ok {
+		// Another instance has this tick
+		return
+	}
+
+	err = runCronJob(ctx, j)
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	run.Status = models.CronSucceeded
+	if err != nil {
+		log.Printf("Cron job %s failed: %v", j.name, err)
+		run.Status = models.CronFailed
+		run.Error = err.Error()
+	}
+	cronRuns.WithLabelValues(j.name, run.Status).Inc()
+	// Recorded even when ctx was cancelled mid-run
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.store.Finish(finishCtx, run); err != nil {
+		log.Printf("Cron job %s: failed to record result: %v", j.name, err)
+	}
+}
+
+// runCronJob calls the job, turning a panic into an error
+func runCronJob(ctx context.Context, j *cronJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+// Run keeps campaigning for leadership and starts due jobs until ctx is
+// done, then waits for running jobs and resigns.
+func (c *Cron) Run(ctx context.Context) {
+	c.Campaign(ctx)
+	campaign := time.NewTicker(cronLeaseRenew)
+	defer campaign.Stop()
+	tick := time.NewTicker(cronTick)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.wg.Wait()
+			resignCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := c.Resign(resignCtx); err != nil {
+				log.Printf("Cron: failed to resign: %v", err)
+			}
+			return
+		case <-campaign.C:
+			if _, err := c.Campaign(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Cron: leader election failed: %v", err)
+			}
+		case now := <-tick.C:
+			c.Tick(ctx, now)
+		}
+	}
+}
+
+// PostgresCronRuns stores cron runs in the cron_runs table
+type PostgresCronRuns struct{}
+
+func (PostgresCronRuns) Start(ctx context.Context, run *models.CronRun) (bool, error) {
+	if DB() == nil {
+		return false, errors.New("database not available")
+	}
+	err := DB().QueryRow(ctx, `
+		INSERT INTO cron_runs (job, scheduled_at, started_at, status, instance)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (job, scheduled_at) DO NOTHING
+		RETURNING id`,
+		run.Job, run.ScheduledAt, run.StartedAt, run.Status, run.Instance).Scan(&run.ID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (PostgresCronRuns) Finish(ctx context.Context, run *models.CronRun) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	_, err := DB().Exec(ctx, "UPDATE cron_runs SET finished_at = $2, status = $3, error = $4 WHERE id = $1",
+		run.ID, run.FinishedAt, run.Status, run.Error)
+	return err
+}
+
+// CronRunFilter selects cron runs; zero fields match everything
+type CronRunFilter struct {
+	Job    string
+	Status string
+	Before int64 // cursor: only runs with a lower ID
+	Limit  int
+}
+
+const cronRunColumns = "id, job, scheduled_at, started_at, finished_at, status, error, instance"
+
+func scanCronRuns(rows pgx.Rows) ([]models.CronRun, error) {
+	defer rows.Close()
+	runs := []models.CronRun{}
+	for rows.Next() {
+		var r models.CronRun
+		if err := rows.Scan(&r.ID, &r.Job, &r.ScheduledAt, &r.StartedAt, &r.FinishedAt, &r.Status, &r.Error, &r.Instance); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// ListCronRuns returns the runs matching f, newest first
+func ListCronRuns(ctx context.Context, f CronRunFilter) ([]models.CronRun, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT `+cronRunColumns+` FROM cron_runs
+		WHERE ($1 = '' OR job = $1) AND ($2 = '' OR status = $2) AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC LIMIT $4`, f.Job, f.Status, f.Before, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCronRuns(rows)
+}
+
+// LastCronRuns returns each job's latest run, by job name
+func LastCronRuns(ctx context.Context) (map[string]models.CronRun, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `SELECT DISTINCT ON (job) `+cronRunColumns+` FROM cron_runs ORDER BY job, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := scanCronRuns(rows)
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[string]models.CronRun, len(runs))
+	for _, r := range runs {
+		last[r.Job] = r
+	}
+	return last, nil
+}
+
+// cronScheduler is set while StartCron runs
+var cronScheduler atomic.Pointer[Cron]
+
+// DefaultCron returns the scheduler run by StartCron, or nil
+func DefaultCron() *Cron {
+	return cronScheduler.Load()
+}
+
+// cronInstanceName identifies this instance: its host name, which is the
+// pod name on Kubernetes, and a random suffix
+func cronInstanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "instance"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// StartCron runs the maintenance jobs on their schedules until ctx is done
+func StartCron(ctx context.Context) {
+	rdb := InitRedis()
+	if rdb == nil {
+		log.Println("Redis not available; every instance schedules cron jobs and cron_runs keeps them from running twice")
+	}
+	c := NewCron(rdb, "cron:leader", cronInstanceName(), PostgresCronRuns{})
+	registerMaintenanceJobs(c)
+	cronScheduler.Store(c)
+	defer cronScheduler.Store(nil)
+
+	log.Printf("Starting cron scheduler as %s with %d jobs", c.Instance(), len(c.Jobs()))
+	c.Run(ctx)
+}
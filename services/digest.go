@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"text/template"
+	"time"
+	"user-notification-api/models"
+)
+
+//go:embed templates/digest.tmpl
+var digestTemplateText string
+
+var digestTemplate = template.Must(template.New("digest").Parse(digestTemplateText))
+
+// DigestData is passed to the digest template
+type DigestData struct {
+	Frequency string
+	Items     []*models.Notification
+}
+
+// RenderDigest renders the digest email body
+func RenderDigest(frequency string, items []*models.Notification) (string, error) {
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, DigestData{Frequency: frequency, Items: items}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SendDueDigests sends one digest to every user whose hourly or daily period
+// has elapsed and who has notifications waiting. Notifications held for users
+// who have since turned their digest off go back to the scheduler.
+func SendDueDigests(ctx context.Context) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	if released, err := releaseDigestHeld(ctx); err != nil {
+		return err
+	} else if released > 0 {
+		log.Printf("Released %d held notifications for users without a digest", released)
+	}
+
+	rows, err := DB().Query(ctx, `
+		SELECT s.user_id FROM notification_settings s
+		WHERE s.digest_frequency IN ('hourly', 'daily')
+		AND (s.last_digest_at IS NULL OR s.last_digest_at <= now() -
+			CASE s.digest_frequency WHEN 'hourly' THEN interval '1 hour' ELSE interval '1 day' END)
+		AND EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = s.user_id AND n.status = $1)`,
+		models.NotificationDigest)
+	if err != nil {
+		return err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := sendDigest(ctx, userID); err != nil {
+			log.Printf("Failed to send digest to user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// releaseDigestHeld reschedules held notifications whose user no longer gets
+// a digest, so the scheduler delivers them one by one
+func releaseDigestHeld(ctx context.Context) (int, error) {
+	tag, err := DB().Exec(ctx, `
+		UPDATE notifications n SET status = $1, send_at = now(), updated_at = now()
+		WHERE n.status = $2 AND NOT EXISTS (
+			SELECT 1 FROM notification_settings s
+			WHERE s.user_id = n.user_id AND s.digest_frequency IN ('hourly', 'daily'))`,
+		models.NotificationScheduled, models.NotificationDigest)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// sendDigest locks the user's settings row so only one replica sends a given
+// digest; the idempotency key covers a crash between sending and committing.
+func sendDigest(ctx context.Context, userID int) error {
+	tx, err := DB().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var frequency string
+	err = tx.QueryRow(ctx, `
+		SELECT digest_frequency FROM notification_settings
+		WHERE user_id = $1 FOR UPDATE SKIP LOCKED`, userID).Scan(&frequency)
+	if err != nil {
+		// Locked by another replica, or settings removed
+		return nil
+	}
+
+	prefs, err := GetPreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if quiet, _ := QuietUntil(prefs.QuietHours, time.Now()); quiet {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id = $1 AND status = $2 ORDER BY id FOR UPDATE`,
+		userID, models.NotificationDigest)
+	if err != nil {
+		return err
+	}
+	var items []*models.Notification
+	var ids []int64
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, n)
+		ids = append(ids, n.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	body, err := RenderDigest(frequency, items)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("Your %s summary: %d notifications", frequency, len(items))
+	key := fmt.Sprintf("digest:%d:%d", userID, ids[len(ids)-1])
+	if err := DeliverEmail(ctx, NotificationOwner(0, ""), key, items[0].Email, subject, body); err != nil && !errors.Is(err, ErrDuplicateNotification) {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE notifications SET status = $2, updated_at = now() WHERE id = ANY($1)`,
+		ids, models.NotificationSent); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"UPDATE notification_settings SET last_digest_at = now() WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	log.Printf("Sent %s digest with %d notifications to user %d", frequency, len(items), userID)
+	return nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"user-notification-api/models"
+)
+
+// Dispatch outcomes
+const (
+	DispatchSent       = "sent"
+	DispatchDuplicate  = "duplicate"
+	DispatchSuppressed = "suppressed"
+	DispatchDeferred   = "deferred"
+	DispatchDigest     = "digest"
+)
+
+// Dispatch delivers one notification after checking the recipient's
+// preferences. Suppressed notifications are dropped, non-urgent ones for
+// digest users are held for the next digest, and deferred ones are
+// rescheduled for the end of the recipient's quiet hours. Users who have
+// the in_app channel enabled also get the notification on their open
+// WebSocket connections.
+func Dispatch(ctx context.Context, msg RegistrationMessage) (string, error) {
+	category, err := NormalizeCategory(msg.Category)
+	if err != nil {
+		if msg.NotificationID != 0 {
+			setNotificationStatus(ctx, msg.NotificationID, models.NotificationFailed, err.Error())
+		}
+		return "", err
+	}
+	msg.Category = category
+	if msg.UserID == 0 {
+		if id, err := userIDByEmail(ctx, msg.Email); err == nil {
+			msg.UserID = id
+		}
+	}
+
+	var prefs *models.NotificationPreferences
+	if msg.UserID != 0 {
+		var err error
+		prefs, err = GetPreferences(ctx, msg.UserID)
+		if err != nil {
+			log.Printf("Failed to load preferences for user %d, delivering anyway: %v", msg.UserID, err)
+			prefs = nil
+		}
+		decision, until := CheckDelivery(prefs, msg.Category, models.ChannelEmail, time.Now())
+		if decision == DeliverySuppress {
+			log.Printf("Suppressed %s notification to user %d by preference", msg.Category, msg.UserID)
+			notifyInApp(ctx, msg, prefs)
+			if msg.NotificationID != 0 {
+				setNotificationStatus(ctx, msg.NotificationID, models.NotificationSuppressed, "")
+			}
+			return DispatchSuppressed, nil
+		}
+		// Digests are sent outside quiet hours, so held notifications skip the deferral
+		if UsesDigest(prefs, msg.Category, msg.Priority) {
+			notifyInApp(ctx, msg, prefs)
+			return DispatchDigest, holdForDigest(ctx, msg)
+		}
+		// The in-app event is pushed when the deferred notification is released
+		if decision == DeliveryDefer {
+			log.Printf("Deferring notification to user %d until %s (quiet hours)", msg.UserID, until.Format(time.RFC3339))
+			return DispatchDeferred, deferNotification(ctx, msg, until)
+		}
+	}
+
+	err = DeliverEmail(ctx, NotificationOwner(msg.CreatedBy, msg.CreatedByName), msg.IdempotencyKey, msg.Email, msg.Subject, msg.Message)
+	if errors.Is(err, ErrDuplicateNotification) {
+		// An earlier delivery sent it but may have stopped before recording that
+		if msg.NotificationID != 0 {
+			setNotificationStatus(ctx, msg.NotificationID, models.NotificationSent, "")
+		}
+		return DispatchDuplicate, nil
+	}
+	if errors.Is(err, ErrIdempotencyUnavailable) {
+		// Nothing was sent, so the caller retries the whole message
+		return "", err
+	}
+	notifyInApp(ctx, msg, prefs)
+	if msg.NotificationID != 0 {
+		status, errMsg := models.NotificationSent, ""
+		if err != nil {
+			status, errMsg = models.NotificationFailed, err.Error()
+		}
+		setNotificationStatus(ctx, msg.NotificationID, status, errMsg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return DispatchSent, nil
+}
+
+// notifyInApp adds the notification to the user's inbox and pushes it, with
+// the new unread count, to their WebSocket connections unless they turned
+// the in_app channel off for its category. Quiet hours do not apply: nothing
+// is shown unless the user opens the app.
+func notifyInApp(ctx context.Context, msg RegistrationMessage, prefs *models.NotificationPreferences) {
+	if msg.UserID == 0 {
+		return
+	}
+	if decision, _ := CheckDelivery(prefs, msg.Category, models.ChannelInApp, time.Now()); decision == DeliverySuppress {
+		return
+	}
+	item := &models.InboxItem{
+		NotificationID: msg.NotificationID,
+		Category:       msg.Category,
+		Priority:       msg.Priority,
+		Subject:        msg.Subject,
+		Message:        msg.Message,
+	}
+	created, err := AddInboxItem(ctx, msg.UserID, item)
+	if err != nil {
+		// Still shown to connected devices, just not kept
+		log.Printf("Failed to add notification to inbox of user %d: %v", msg.UserID, err)
+	} else if !created {
+		return
+	}
+	Notify(msg.UserID, Event{Type: EventNotification, Data: item})
+	if created {
+		PushUnreadCount(ctx, msg.UserID)
+	}
+}
+
+// deferNotification moves a notification back to the scheduler. Messages
+// without a record get one, keyed by their idempotency key so a redelivered
+// message is not scheduled twice.
+func deferNotification(ctx context.Context, msg RegistrationMessage, until time.Time) error {
+	if msg.NotificationID != 0 {
+		_, err := DB().Exec(ctx, `
+			UPDATE notifications SET status = $2, send_at = $3, updated_at = now()
+			WHERE id = $1`, msg.NotificationID, models.NotificationScheduled, until)
+		return err
+	}
+	_, err := ScheduleNotification(ctx, &models.Notification{
+		UserID:         msg.UserID,
+		Email:          msg.Email,
+		Category:       msg.Category,
+		Priority:       msg.Priority,
+		Subject:        msg.Subject,
+		Message:        msg.Message,
+		IdempotencyKey: msg.IdempotencyKey,
+		CreatedBy:      msg.CreatedBy,
+		CreatedByName:  msg.CreatedByName,
+		SendAt:         until,
+	})
+	return err
+}
+
+// holdForDigest marks a notification for the user's next digest, creating a
+// record for messages that do not have one yet.
+func holdForDigest(ctx context.Context, msg RegistrationMessage) error {
+	if msg.NotificationID != 0 {
+		_, err := DB().Exec(ctx, `
+			UPDATE notifications SET status = $2, updated_at = now()
+			WHERE id = $1`, msg.NotificationID, models.NotificationDigest)
+		return err
+	}
+	_, err := ScheduleNotification(ctx, &models.Notification{
+		UserID:         msg.UserID,
+		Email:          msg.Email,
+		Category:       msg.Category,
+		Priority:       msg.Priority,
+		Subject:        msg.Subject,
+		Message:        msg.Message,
+		IdempotencyKey: msg.IdempotencyKey,
+		CreatedBy:      msg.CreatedBy,
+		CreatedByName:  msg.CreatedByName,
+		Status:         models.NotificationDigest,
+	})
+	return err
+}
@@ -3,13 +3,13 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
-	pb "user-notification-api/proto"
-
 	"github.com/segmentio/kafka-go"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
@@ -20,35 +20,42 @@ type RegistrationMessage struct {
 	Email   string `json:"email"`
 	Subject string `json:"subject,omitempty"` // Optional, with default if missing
 	Message string `json:"message,omitempty"` // Optional, with default if missing
+	// IdempotencyKey deduplicates redeliveries; defaults to the Kafka offset
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// CreatedBy is the user who sent the notification, 0 for the system, and
+	// CreatedByName the API key or certificate; together they scope
+	// IdempotencyKey
+	CreatedBy     int    `json:"created_by,omitempty"`
+	CreatedByName string `json:"created_by_name,omitempty"`
+	// NotificationID links the message to a scheduled notification record
+	NotificationID int64 `json:"notification_id,omitempty"`
+	// UserID and Category select the preferences applied on dispatch
+	UserID   int    `json:"user_id,omitempty"`
+	Category string `json:"category,omitempty"`
+	// Priority "high" bypasses the user's digest
+	Priority string `json:"priority,omitempty"`
 }
 
-var kafkaReader *kafka.Reader
+// RegistrationTopic carries welcome and notification emails to the consumer
+const RegistrationTopic = "user-registration"
 
-// NotificationServer implements the gRPC NotificationService
-type NotificationServer struct {
-	pb.UnimplementedNotificationServiceServer
-}
+var kafkaReader *kafka.Reader
 
-func (s *NotificationServer) SendNotification(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
-	err := sendEmail(req.Email, req.Subject, req.Message)
-	if err != nil {
-		log.Printf("gRPC SendNotification failed for %s: %v", req.Email, err)
-		return &pb.NotificationResponse{Success: false, Error: err.Error()}, nil
+func kafkaBroker() string {
+	broker := os.Getenv("KAFKA_BROKER")
+	if broker == "" {
+		broker = "localhost:9092"
+		log.Println("KAFKA_BROKER not set, defaulting to localhost:9092")
 	}
-	log.Printf("gRPC Sent notification to %s", req.Email)
-	return &pb.NotificationResponse{Success: true, Error: ""}, nil
+	return broker
 }
 
 // KafkaWriter returns the writer instance
 func KafkaWriter() *kafka.Writer {
-	broker := os.Getenv("KAFKA_BROKER")
-	if broker == "" {
-		broker = "localhost:9092"
-		log.Println("KAFKA_BROKER not set, defaulting to kafka:9092")
-	}
+	broker := kafkaBroker()
 	writer := &kafka.Writer{
 		Addr:     kafka.TCP(broker),
-		Topic:    "user-registration",
+		Topic:    RegistrationTopic,
 		Balancer: &kafka.LeastBytes{},
 	}
 	conn, err := kafka.Dial("tcp", broker)
@@ -61,92 +68,121 @@ func KafkaWriter() *kafka.Writer {
 	return writer
 }
 
-func StartEmailConsumer() {
-	broker := os.Getenv("KAFKA_BROKER")
-	if broker == "" {
-		broker = "localhost:9092"
-		log.Println("KAFKA_BROKER not set, defaulting to localhost:9092")
-	}
+// StartEmailConsumer sends the emails published to the registration topic
+// until ctx is done. A message being sent when ctx is cancelled is finished
+// and committed first; the reader is closed on the way out.
+func StartEmailConsumer(ctx context.Context) {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{broker},
-		Topic:    "user-registration",
+		Brokers:  []string{kafkaBroker()},
+		Topic:    RegistrationTopic,
 		GroupID:  "email-consumer-group",
 		MinBytes: 10e3,
 		MaxBytes: 10e6,
 	})
-
-	// Ensure reader is not closed prematurely
 	defer func() {
 		if err := r.Close(); err != nil {
 			log.Printf("Failed to close Kafka reader: %v", err)
 		}
 	}()
+	defer trackKafkaConsumer("email", r)()
 
-	for i := 0; i < 5; i++ {
-		_, err := r.FetchMessage(context.Background())
+	// In-flight work is not cut short by shutdown
+	work := context.WithoutCancel(ctx)
+	log.Println("Starting Kafka email consumer")
+	for {
+		msg, err := r.FetchMessage(ctx)
 		if err != nil {
-			log.Printf("Failed to connect to Kafka for consumer (attempt %d): %v", i, err)
-			time.Sleep(5 * time.Second)
+			if ctx.Err() != nil {
+				log.Println("Stopping Kafka email consumer")
+				return
+			}
+			log.Printf("Failed to read Kafka message: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
 			continue
 		}
-		log.Println("Connected to Kafka for consumer successfully")
-		break
-		/*conn, err := kafka.Dial("tcp", broker)
-		if err == nil {
-			log.Println("Connected to Kafka for consumer successfully")
-			conn.Close()
-			break
-		}
-		log.Printf("Failed to connect to Kafka for consumer (attempt %d): %v", i+1, err)
-		if i == 4 {
-			log.Println("Giving up on Kafka consumer after 5 attempts")
+		if !handleEmailMessage(ctx, work, msg) {
+			// Left uncommitted, so it is delivered again after a restart
 			return
 		}
-		time.Sleep(5 * time.Second)*/
+		if err := r.CommitMessages(work, msg); err != nil {
+			log.Printf("Failed to commit Kafka message at offset %d: %v", msg.Offset, err)
+		}
 	}
+}
 
-	/*kafkaReader = kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{broker},
-		Topic:    "user-registration",
-		GroupID:  "email-consumer-group",
-		MinBytes: 10e3,
-		MaxBytes: 10e6,
-	})*/
+// handleEmailMessage dispatches one message from the registration topic with
+// the work context. While idempotency keys cannot be checked it keeps
+// retrying until ctx is done, so the offset is only committed once the email
+// was sent or definitely failed. It returns false if it gave up on shutdown.
+func handleEmailMessage(ctx, work context.Context, msg kafka.Message) bool {
+	var regMsg RegistrationMessage
+	if err := json.Unmarshal(msg.Value, &regMsg); err != nil {
+		log.Printf("Failed to unmarshal message: %v", err)
+		return true
+	}
 
-	defer r.Close()
-	log.Println("Starting Kafka email consumer")
-	for {
-		msg, err := r.ReadMessage(context.Background())
-		if err != nil {
-			log.Printf("Failed to read Kafka message: %v", err)
-			continue
-		}
+	// Provide defaults if subject or message are missing
+	if regMsg.Subject == "" {
+		regMsg.Subject = "Welcome to User Notification API"
+	}
+	if regMsg.Message == "" {
+		regMsg.Message = "Thanks for registering! Enjoy our services."
+	}
 
-		var regMsg RegistrationMessage
-		if err := json.Unmarshal(msg.Value, &regMsg); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			continue
-		}
+	if regMsg.IdempotencyKey == "" {
+		regMsg.IdempotencyKey = fmt.Sprintf("kafka:%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	}
 
-		// Provide defaults if subject or message are missing
-		subject := regMsg.Subject
-		if subject == "" {
-			subject = "Welcome to User Notification API"
-		}
-		message := regMsg.Message
-		if message == "" {
-			message = "Thanks for registering! Enjoy our services."
+	for {
+		result, err := Dispatch(work, regMsg)
+		if errors.Is(err, ErrIdempotencyUnavailable) {
+			log.Printf("Retrying email to %s: %v", regMsg.Email, err)
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(5 * time.Second):
+			}
+			continue
 		}
-
-		if err := sendEmail(regMsg.Email, subject, message); err != nil {
+		if err != nil {
 			log.Printf("Failed to send email to %s: %v", regMsg.Email, err)
 		} else {
-			log.Printf("Sent welcome email to %s", regMsg.Email)
+			log.Printf("Email to %s: %s", regMsg.Email, result)
 		}
+		return true
 	}
 }
 
+// EmailSender delivers a single email
+type EmailSender func(toEmail, subject, message string) error
+
+var (
+	emailSenderMu sync.RWMutex
+	emailSender   EmailSender = sendGridEmail
+)
+
+// SetEmailSender replaces how emails are delivered; nil restores SendGrid
+func SetEmailSender(send EmailSender) {
+	if send == nil {
+		send = sendGridEmail
+	}
+	emailSenderMu.Lock()
+	defer emailSenderMu.Unlock()
+	emailSender = send
+}
+
 func sendEmail(toEmail, subject, message string) error {
+	emailSenderMu.RLock()
+	send := emailSender
+	emailSenderMu.RUnlock()
+	return send(toEmail, subject, message)
+}
+
+func sendGridEmail(toEmail, subject, message string) error {
 	apiKey := os.Getenv("SENDGRID_API_KEY")
 	if apiKey == "" {
 		return fmt.Errorf("SENDGRID_API_KEY not set")
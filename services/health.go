@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pb "user-notification-api/proto"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Dependency names reported by the gRPC health service
+const (
+	HealthPostgres = "postgres"
+	HealthRedis    = "redis"
+	HealthKafka    = "kafka"
+)
+
+const (
+	healthCheckInterval = 10 * time.Second
+	healthCheckTimeout  = 3 * time.Second
+)
+
+// CheckDependencies probes Postgres, Redis and Kafka and returns the error
+// for each, nil when the dependency is reachable.
+func CheckDependencies(ctx context.Context) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	return map[string]error{
+		HealthPostgres: checkPostgres(ctx),
+		HealthRedis:    checkRedis(ctx),
+		HealthKafka:    checkKafka(ctx),
+	}
+}
+
+func checkPostgres(ctx context.Context) error {
+	// Use the pool directly; DB() would try to reconnect on every probe
+	if db == nil {
+		return errors.New("database not initialized")
+	}
+	var one int
+	return db.QueryRow(ctx, "SELECT 1").Scan(&one)
+}
+
+func checkRedis(ctx context.Context) error {
+	if redisClient == nil {
+		return errors.New("redis not initialized")
+	}
+	return redisClient.Ping(ctx).Err()
+}
+
+func checkKafka(ctx context.Context) error {
+	conn, err := (&kafka.Dialer{Timeout: healthCheckTimeout}).DialContext(ctx, "tcp", kafkaBroker())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// UpdateHealth publishes the dependency results on hs. The overall status
+// ("") and the NotificationService follow Postgres: without it nothing can
+// be enqueued, while Redis only deduplicates and the outbox buffers
+// messages until Kafka is back.
+func UpdateHealth(hs *health.Server, results map[string]error) {
+	for name, err := range results {
+		hs.SetServingStatus(name, servingStatus(err))
+	}
+	overall := servingStatus(results[HealthPostgres])
+	hs.SetServingStatus("", overall)
+	hs.SetServingStatus(pb.NotificationService_ServiceDesc.ServiceName, overall)
+}
+
+// StartHealthChecks refreshes the health statuses until ctx is cancelled
+func StartHealthChecks(ctx context.Context, hs *health.Server) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	var last map[string]error
+	for {
+		results := CheckDependencies(ctx)
+		for name, err := range results {
+			prev, seen := last[name]
+			switch {
+			case err != nil && (!seen || prev == nil):
+				log.Printf("Health: %s unavailable: %v", name, err)
+			case err == nil && seen && prev != nil:
+				log.Printf("Health: %s recovered", name)
+			}
+		}
+		last = results
+		UpdateHealth(hs, results)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func servingStatus(err error) healthpb.HealthCheckResponse_ServingStatus {
+	if err != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// idempotencyTTL is how long a delivered key is remembered
+const idempotencyTTL = 24 * time.Hour
+
+// ErrDuplicateNotification is returned when a key has already been used
+var ErrDuplicateNotification = errors.New("notification already sent for idempotency key")
+
+// ErrIdempotencyUnavailable is returned when a key cannot be checked. Nothing
+// was sent; the delivery should be retried later.
+var ErrIdempotencyUnavailable = errors.New("idempotency store unavailable")
+
+// NotificationOwner names who sent a notification: the user, or for API keys
+// and certificates, which have no user, their name. The system is user 0.
+func NotificationOwner(userID int, name string) string {
+	if name != "" {
+		return "client:" + name
+	}
+	return "user:" + strconv.Itoa(userID)
+}
+
+// idempotencyRedisKey scopes key to its NotificationOwner, so one caller's
+// keys never match another's
+func idempotencyRedisKey(owner, key string) string {
+	return "notification:dedup:" + owner + ":" + key
+}
+
+// ClaimIdempotencyKey marks the owner's key as in progress. It returns false
+// if the key was already claimed by an earlier delivery.
+func ClaimIdempotencyKey(ctx context.Context, owner, key string) (bool, error) {
+	if redisClient == nil {
+		return false, errors.New("redis not initialized")
+	}
+	return redisClient.SetNX(ctx, idempotencyRedisKey(owner, key), "pending", idempotencyTTL).Result()
+}
+
+// CompleteIdempotencyKey records that the provider accepted the notification
+func CompleteIdempotencyKey(ctx context.Context, owner, key string) {
+	if redisClient == nil {
+		return
+	}
+	if err := redisClient.Set(ctx, idempotencyRedisKey(owner, key), "sent", idempotencyTTL).Err(); err != nil {
+		log.Printf("Redis set error for idempotency key %s: %v", key, err)
+	}
+}
+
+// ReleaseIdempotencyKey frees the key after the provider rejected the
+// notification, so a retry with the same key can go through.
+func ReleaseIdempotencyKey(ctx context.Context, owner, key string) {
+	if redisClient == nil {
+		return
+	}
+	if err := redisClient.Del(ctx, idempotencyRedisKey(owner, key)).Err(); err != nil {
+		log.Printf("Redis del error for idempotency key %s: %v", key, err)
+	}
+}
+
+// DeliverEmail sends an email at most once per owner and idempotency key. An
+// empty key disables deduplication. If Redis is unavailable nothing is sent
+// and ErrIdempotencyUnavailable is returned.
+func DeliverEmail(ctx context.Context, owner, idempotencyKey, toEmail, subject, message string) error {
+	if idempotencyKey == "" {
+		return sendEmail(toEmail, subject, message)
+	}
+
+	claimed, err := ClaimIdempotencyKey(ctx, owner, idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("%w: key %s: %v", ErrIdempotencyUnavailable, idempotencyKey, err)
+	}
+	if !claimed {
+		log.Printf("Skipping duplicate notification to %s (key %s)", toEmail, idempotencyKey)
+		return ErrDuplicateNotification
+	}
+
+	if err := sendEmail(toEmail, subject, message); err != nil {
+		ReleaseIdempotencyKey(ctx, owner, idempotencyKey)
+		return err
+	}
+	CompleteIdempotencyKey(ctx, owner, idempotencyKey)
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EventUnreadCount carries the user's unread inbox count
+const EventUnreadCount = "unread_count"
+
+const (
+	defaultInboxRetention = 30 * 24 * time.Hour
+	inboxPurgeBatch       = 1000
+)
+
+var ErrInboxItemNotFound = errors.New("inbox item not found")
+
+const inboxColumns = `id, COALESCE(notification_id, 0), category, priority, subject, message, read_at, created_at, expires_at`
+
+// InboxRetention is how long inbox items are kept, read or not; set
+// INBOX_RETENTION (e.g. "168h") to change the 30 day default.
+func InboxRetention() time.Duration {
+	if v := os.Getenv("INBOX_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Ignoring invalid INBOX_RETENTION %q", v)
+	}
+	return defaultInboxRetention
+}
+
+// AddInboxItem stores item in userID's inbox. An item for a notification
+// already in the inbox, e.g. a redelivered message, is not added again and
+// created is false.
+func AddInboxItem(ctx context.Context, userID int, item *models.InboxItem) (created bool, err error) {
+	if DB() == nil {
+		return false, errors.New("database not available")
+	}
+	err = DB().QueryRow(ctx, `
+		INSERT INTO inbox_items (user_id, notification_id, category, priority, subject, message, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, now() + $7::interval)
+		ON CONFLICT (user_id, notification_id) WHERE notification_id IS NOT NULL DO NOTHING
+		RETURNING id, created_at, expires_at`,
+		userID, item.NotificationID, item.Category, item.Priority, item.Subject, item.Message, InboxRetention().String(),
+	).Scan(&item.ID, &item.CreatedAt, &item.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListInbox returns up to limit unexpired items, newest first, starting
+// before the given item ID (0 for the newest).
+func ListInbox(ctx context.Context, userID int, unreadOnly bool, before int64, limit int) ([]models.InboxItem, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT "+inboxColumns+`
+		FROM inbox_items
+		WHERE user_id = $1 AND expires_at > now() AND ($2 = 0 OR id < $2) AND (NOT $3 OR read_at IS NULL)
+		ORDER BY id DESC LIMIT $4`, userID, before, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanInboxItems(rows)
+}
+
+// InboxSince returns the newest limit unexpired items after the given item
+// ID, oldest first, for a client resuming its event stream
+func InboxSince(ctx context.Context, userID int, after int64, limit int) ([]models.InboxItem, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT "+inboxColumns+`
+		FROM inbox_items
+		WHERE user_id = $1 AND id > $2 AND expires_at > now()
+		ORDER BY id DESC LIMIT $3`, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items, err := scanInboxItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+func scanInboxItems(rows pgx.Rows) ([]models.InboxItem, error) {
+	items := []models.InboxItem{}
+	for rows.Next() {
+		var item models.InboxItem
+		if err := rows.Scan(&item.ID, &item.NotificationID, &item.Category, &item.Priority, &item.Subject,
+			&item.Message, &item.ReadAt, &item.CreatedAt, &item.ExpiresAt); err != nil {
+			return nil, err
+		}
+		item.Read = item.ReadAt != nil
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// UnreadCount returns the number of unread, unexpired items in userID's inbox
+func UnreadCount(ctx context.Context, userID int) (int, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	var n int
+	err := DB().QueryRow(ctx,
+		"SELECT count(*) FROM inbox_items WHERE user_id = $1 AND read_at IS NULL AND expires_at > now()",
+		userID).Scan(&n)
+	return n, err
+}
+
+// MarkInboxRead marks one item read; marking it again keeps the first read time
+func MarkInboxRead(ctx context.Context, userID int, id int64) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx, `
+		UPDATE inbox_items SET read_at = COALESCE(read_at, now())
+		WHERE id = $1 AND user_id = $2 AND expires_at > now()`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInboxItemNotFound
+	}
+	return nil
+}
+
+// MarkAllInboxRead marks every unread item read and returns how many changed
+func MarkAllInboxRead(ctx context.Context, userID int) (int64, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx,
+		"UPDATE inbox_items SET read_at = now() WHERE user_id = $1 AND read_at IS NULL", userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// PushUnreadCount sends the current unread count to all of userID's
+// connections, so the badge stays in sync across devices
+func PushUnreadCount(ctx context.Context, userID int) {
+	n, err := UnreadCount(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to count unread inbox items for user %d: %v", userID, err)
+		return
+	}
+	Notify(userID, Event{Type: EventUnreadCount, Data: models.UnreadCount{Unread: n}})
+}
+
+// PurgeExpiredInbox deletes expired items in batches and returns how many
+// were removed
+func PurgeExpiredInbox(ctx context.Context) (int64, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	var total int64
+	for {
+		tag, err := DB().Exec(ctx, `
+			DELETE FROM inbox_items WHERE id IN (
+				SELECT id FROM inbox_items WHERE expires_at <= now() LIMIT $1)`, inboxPurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < inboxPurgeBatch {
+			return total, nil
+		}
+	}
+}
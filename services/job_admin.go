@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobRunning      = errors.New("job is running")
+	ErrJobNotFailed    = errors.New("only failed jobs can be retried")
+	ErrUnknownJobType  = errors.New("unknown job type")
+	ErrInvalidJobState = errors.New("state must be queued, retrying, running, paused, failed or completed")
+)
+
+// Administration of a JobQueue: listing jobs by state, retrying and deleting
+// them, and pausing job types. Each job type is a queue of its own for
+// pausing: while it is paused, workers set its jobs aside instead of running
+// them, and resuming puts them back in line. Jobs already running finish.
+
+func (q *JobQueue) parkedKey(jobType string) string {
+	return q.key("parked:" + jobType)
+}
+
+// Types returns the job types with a handler, sorted
+func (q *JobQueue) Types() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	types := make([]string, 0, len(q.handlers))
+	for t := range q.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// PausedTypes returns the paused job types, sorted
+func (q *JobQueue) PausedTypes(ctx context.Context) ([]string, error) {
+	types, err := q.rdb.SMembers(ctx, q.key("paused")).Result()
+	sort.Strings(types)
+	return types, err
+}
+
+// Counts returns the number of jobs in each state
+func (q *JobQueue) Counts(ctx context.Context) (map[string]int64, error) {
+	paused, err := q.PausedTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipe := q.rdb.Pipeline()
+	queued := pipe.LLen(ctx, q.key("ready"))
+	retrying := pipe.ZCard(ctx, q.key("delayed"))
+	running := pipe.LLen(ctx, q.key("processing"))
+	failed := pipe.LLen(ctx, q.key("dead"))
+	completed := pipe.LLen(ctx, q.key("completed"))
+	parked := make([]*redis.IntCmd, len(paused))
+	for i, t := range paused {
+		parked[i] = pipe.LLen(ctx, q.parkedKey(t))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{
+		models.JobQueued:    queued.Val(),
+		models.JobRetrying:  retrying.Val(),
+		models.JobRunning:   running.Val(),
+		models.JobPaused:    0,
+		models.JobFailed:    failed.Val(),
+		models.JobCompleted: completed.Val(),
+	}
+	for _, n := range parked {
+		counts[models.JobPaused] += n.Val()
+	}
+	return counts, nil
+}
+
+// ListJobs returns up to limit jobs in state, skipping the first offset.
+// Lists are newest first, except retrying jobs, which come in the order they
+// will run.
+func (q *JobQueue) ListJobs(ctx context.Context, state string, offset, limit int64) ([]models.Job, error) {
+	var keys []string
+	switch state {
+	case models.JobQueued:
+		keys = []string{q.key("ready")}
+	case models.JobRetrying:
+		keys = []string{q.key("delayed")}
+	case models.JobRunning:
+		keys = []string{q.key("processing")}
+	case models.JobFailed:
+		keys = []string{q.key("dead")}
+	case models.JobCompleted:
+		keys = []string{q.key("completed")}
+	case models.JobPaused:
+		paused, err := q.PausedTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range paused {
+			keys = append(keys, q.parkedKey(t))
+		}
+	default:
+		return nil, ErrInvalidJobState
+	}
+
+	// The lists are read one after the other, as if they were one
+	var ids []string
+	for _, key := range keys {
+		if int64(len(ids)) >= limit {
+			break
+		}
+		var n int64
+		var err error
+		if state == models.JobRetrying {
+			n, err = q.rdb.ZCard(ctx, key).Result()
+		} else {
+			n, err = q.rdb.LLen(ctx, key).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if offset >= n {
+			offset -= n
+			continue
+		}
+		stop := offset + limit - int64(len(ids)) - 1
+		var page []string
+		if state == models.JobRetrying {
+			page, err = q.rdb.ZRange(ctx, key, offset, stop).Result()
+		} else {
+			page, err = q.rdb.LRange(ctx, key, offset, stop).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, page...)
+		offset = 0
+	}
+
+	jobs := []models.Job{}
+	if len(ids) == 0 {
+		return jobs, nil
+	}
+	data, err := q.rdb.HMGet(ctx, q.key("data"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range data {
+		// Jobs settled or deleted since the IDs were read are skipped
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var job models.Job
+		if json.Unmarshal([]byte(s), &job) == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (q *JobQueue) getJob(ctx context.Context, id string) (*models.Job, error) {
+	data, err := q.rdb.HGet(ctx, q.key("data"), id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+var (
+	// KEYS: dead, data, ready; ARGV: id, job
+	jobResurrectScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+		redis.call('LPUSH', KEYS[3], ARGV[1])
+		return 1`)
+	// KEYS: processing, data, delayed, then every list that may hold the job; ARGV: id
+	jobDeleteScript = redis.NewScript(`
+		if redis.call('LPOS', KEYS[1], ARGV[1]) then return -1 end
+		redis.call('ZREM', KEYS[3], ARGV[1])
+		for i = 4, #KEYS do
+			redis.call('LREM', KEYS[i], 0, ARGV[1])
+		end
+		return redis.call('HDEL', KEYS[2], ARGV[1])`)
+	// KEYS: paused types, parked, ready; ARGV: job type
+	jobResumeScript = redis.NewScript(`
+		redis.call('SREM', KEYS[1], ARGV[1])
+		local n = 0
+		while redis.call('RPOPLPUSH', KEYS[2], KEYS[3]) do n = n + 1 end
+		return n`)
+)
+
+// RetryJob queues a failed job again with a fresh set of attempts
+func (q *JobQueue) RetryJob(ctx context.Context, id string) (*models.Job, error) {
+	job, err := q.getJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	job.Attempts = 0
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	if h, ok := q.handler(job.Type); ok {
+		job.MaxAttempts = h.opts.MaxAttempts
+	}
+	encoded, _ := json.Marshal(job)
+	n, err := jobResurrectScript.Run(ctx, q.rdb, []string{q.key("dead"), q.key("data"), q.key("ready")}, id, encoded).Int()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrJobNotFailed
+	}
+	return job, nil
+}
+
+// DeleteJob removes a job that is not running, whatever its state
+func (q *JobQueue) DeleteJob(ctx context.Context, id string) error {
+	job, err := q.getJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	keys := []string{q.key("processing"), q.key("data"), q.key("ready"), q.key("delayed"),
+		q.key("dead"), q.key("completed"), q.parkedKey(job.Type)}
+	n, err := jobDeleteScript.Run(ctx, q.rdb, keys, id).Int()
+	switch {
+	case err != nil:
+		return err
+	case n < 0:
+		return ErrJobRunning
+	case n == 0:
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// PauseType stops workers from running jobs of jobType until ResumeType
+func (q *JobQueue) PauseType(ctx context.Context, jobType string) error {
+	if _, ok := q.handler(jobType); !ok {
+		return ErrUnknownJobType
+	}
+	return q.rdb.SAdd(ctx, q.key("paused"), jobType).Err()
+}
+
+// ResumeType lets workers run jobs of jobType again, queueing the jobs set
+// aside while it was paused behind those already waiting. It returns how
+// many there were.
+func (q *JobQueue) ResumeType(ctx context.Context, jobType string) (int64, error) {
+	if _, ok := q.handler(jobType); !ok {
+		return 0, ErrUnknownJobType
+	}
+	return jobResumeScript.Run(ctx, q.rdb, []string{q.key("paused"), q.parkedKey(jobType), q.key("ready")}, jobType).Int64()
+}
+
+// JobQueueOverview summarizes a queue for the admin dashboard
+type JobQueueOverview struct {
+	Counts map[string]int64 `json:"counts"`
+	Types  []JobTypeStatus  `json:"types"`
+	// OldestQueuedMs is how long the job next in line has been waiting
+	OldestQueuedMs int64 `json:"oldest_queued_ms"`
+}
+
+// JobTypeStatus is a job type and whether it is paused
+type JobTypeStatus struct {
+	Type   string `json:"type"`
+	Paused bool   `json:"paused"`
+}
+
+// Overview returns the job counts by state and the status of each job type
+func (q *JobQueue) Overview(ctx context.Context) (*JobQueueOverview, error) {
+	counts, err := q.Counts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := q.PausedTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isPaused := make(map[string]bool)
+	for _, t := range paused {
+		isPaused[t] = true
+	}
+	o := &JobQueueOverview{Counts: counts, Types: []JobTypeStatus{}}
+	for _, t := range q.Types() {
+		o.Types = append(o.Types, JobTypeStatus{Type: t, Paused: isPaused[t]})
+	}
+
+	next, err := q.rdb.LIndex(ctx, q.key("ready"), -1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if next != "" {
+		if job, err := q.getJob(ctx, next); err == nil {
+			o.OldestQueuedMs = time.Since(job.EnqueuedAt).Milliseconds()
+		}
+	}
+	return o, nil
+}
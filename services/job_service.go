@@ -2,18 +2,545 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// Job queue defaults
+const (
+	DefaultJobConcurrency       = 4
+	DefaultJobMaxAttempts       = 5
+	DefaultJobVisibilityTimeout = 5 * time.Minute
+	DefaultJobPollTimeout       = 5 * time.Second
+	jobMaintenanceInterval      = time.Second
+	jobRetryBase                = 5 * time.Second
+	jobRetryMax                 = 10 * time.Minute
+	jobPromoteBatch             = 100
+	// CompletedJobsKept is how many finished jobs are kept for inspection
+	CompletedJobsKept = 1000
+)
+
+// Built-in job types
+const (
+	JobSendEmail = "send_email"
+)
+
+// SendEmailJob is the payload of a send_email job
+type SendEmailJob struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+var ErrJobQueueUnavailable = errors.New("job queue not available")
+
+var (
+	jobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "job_duration_seconds",
+			Help:    "Time spent running job attempts, by job type and outcome",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 9),
+		},
+		[]string{"type", "outcome"},
+	)
+	jobWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "job_wait_seconds",
+			Help:    "Time from enqueueing a job to its first attempt, by job type",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 9),
+		},
+		[]string{"type"},
+	)
+	jobQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "job_queue_depth",
+			Help: "Jobs in the queue, by state",
+		},
+		[]string{"state"},
+	)
 )
 
-func QueueJob(jobType, data string) {
-	redisClient.LPush(context.Background(), "jobs", fmt.Sprintf("%s:%s", jobType, data))
+func init() {
+	prometheus.MustRegister(jobDuration, jobWait, jobQueueDepth)
+}
+
+// JobHandler runs one job. Returning an error retries the job with backoff
+// until it runs out of attempts; errors wrapped with PermanentJobError are
+// not retried.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// JobOptions configure a job type; zero values take the queue defaults
+type JobOptions struct {
+	MaxAttempts int
+	// Timeout bounds one attempt. A job whose worker has not finished within
+	// it is handed to another worker, so it also covers workers that died.
+	Timeout time.Duration
+}
+
+type permanentJobError struct{ err error }
+
+func (e permanentJobError) Error() string { return e.err.Error() }
+func (e permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError marks a job failure that retrying cannot fix
+func PermanentJobError(err error) error {
+	return permanentJobError{err}
+}
+
+// JobQueue is a reliable job queue in Redis. Jobs wait in a ready list; a
+// worker moves a job ID atomically to the processing list with BLMOVE and
+// leases it for the job type's timeout. Finished jobs go to the completed
+// list, which keeps the last CompletedJobsKept, failed ones wait in the
+// delayed set until their retry, and jobs out of attempts go to the dead
+// list. Jobs whose lease expires, because their worker died or stalled, go
+// back to the ready list, so every job runs at least once. Jobs of a paused
+// type are set aside in a list of their own until the type is resumed.
+type JobQueue struct {
+	Concurrency int                             // workers started by Run
+	PollTimeout time.Duration                   // how long a worker blocks waiting for a job
+	Backoff     func(attempt int) time.Duration // delay before retrying after a failed attempt
+
+	rdb    *redis.Client
+	prefix string
+
+	mu       sync.RWMutex
+	handlers map[string]jobHandler
+
+	// unleased holds processing IDs seen without a lease by the last
+	// maintenance pass; a worker leases a job right after moving it, so IDs
+	// still unleased on the next pass belong to a worker that died.
+	unleased map[string]bool
+}
+
+type jobHandler struct {
+	run  JobHandler
+	opts JobOptions
+}
+
+// NewJobQueue returns a queue whose keys start with prefix
+func NewJobQueue(rdb *redis.Client, prefix string) *JobQueue {
+	return &JobQueue{
+		Concurrency: DefaultJobConcurrency,
+		PollTimeout: DefaultJobPollTimeout,
+		Backoff:     JobRetryBackoff,
+		rdb:         rdb,
+		prefix:      prefix,
+		handlers:    make(map[string]jobHandler),
+		unleased:    make(map[string]bool),
+	}
+}
+
+// JobRetryBackoff doubles the delay with every attempt, from 5s up to 10m
+func JobRetryBackoff(attempt int) time.Duration {
+	d := jobRetryBase
+	for i := 1; i < attempt && d < jobRetryMax; i++ {
+		d *= 2
+	}
+	if d > jobRetryMax {
+		d = jobRetryMax
+	}
+	return d
+}
+
+func (q *JobQueue) key(name string) string {
+	return q.prefix + ":" + name
+}
+
+// Handle registers the handler for a job type
+func (q *JobQueue) Handle(jobType string, opts JobOptions, h JobHandler) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultJobMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultJobVisibilityTimeout
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = jobHandler{run: h, opts: opts}
+}
+
+// HandleJob registers a handler for jobs of jobType whose payload decodes
+// into T. Payloads that do not decode fail permanently.
+func HandleJob[T any](q *JobQueue, jobType string, opts JobOptions, h func(ctx context.Context, payload T) error) {
+	q.Handle(jobType, opts, func(ctx context.Context, job *models.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return PermanentJobError(fmt.Errorf("invalid %s payload: %v", jobType, err))
+		}
+		return h(ctx, payload)
+	})
+}
+
+func (q *JobQueue) handler(jobType string) (jobHandler, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	h, ok := q.handlers[jobType]
+	return h, ok
+}
+
+// Enqueue adds a job and returns its ID. payload is encoded as JSON.
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	job := models.Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: DefaultJobMaxAttempts,
+		EnqueuedAt:  time.Now().UTC(),
+	}
+	if h, ok := q.handler(jobType); ok {
+		job.MaxAttempts = h.opts.MaxAttempts
+	}
+	encoded, _ := json.Marshal(job)
+	pipe := q.rdb.TxPipeline()
+	pipe.HSet(ctx, q.key("data"), job.ID, encoded)
+	pipe.LPush(ctx, q.key("ready"), job.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Scripts that take a job off the processing list. Each first removes the ID
+// from the list, so a worker whose lease expired and the worker that took the
+// job over cannot both settle it.
+var (
+	// KEYS: processing, leases, data; ARGV: id
+	jobDropScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		redis.call('HDEL', KEYS[3], ARGV[1])
+		return 1`)
+	// KEYS: processing, leases, data, completed; ARGV: id, job, jobs kept.
+	// The oldest completed jobs beyond the limit are deleted.
+	jobCompleteScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+		redis.call('LPUSH', KEYS[4], ARGV[1])
+		while redis.call('LLEN', KEYS[4]) > tonumber(ARGV[3]) do
+			redis.call('HDEL', KEYS[3], redis.call('RPOP', KEYS[4]))
+		end
+		return 1`)
+	// KEYS: processing, leases, paused types, parked; ARGV: id, job type.
+	// Returns 0, leaving the job where it is, if its type is not paused.
+	jobParkScript = redis.NewScript(`
+		if redis.call('SISMEMBER', KEYS[3], ARGV[2]) == 0 then return 0 end
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+			redis.call('ZREM', KEYS[2], ARGV[1])
+			redis.call('LPUSH', KEYS[4], ARGV[1])
+		end
+		return 1`)
+	// KEYS: processing, leases, data, delayed; ARGV: id, job, retry at
+	jobRetryScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+		redis.call('ZADD', KEYS[4], ARGV[3], ARGV[1])
+		return 1`)
+	// KEYS: processing, leases, data, dead; ARGV: id, job
+	jobBuryScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+		redis.call('LPUSH', KEYS[4], ARGV[1])
+		return 1`)
+	// KEYS: processing, leases, ready; ARGV: id. Requeued jobs run next.
+	jobRequeueScript = redis.NewScript(`
+		if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		redis.call('RPUSH', KEYS[3], ARGV[1])
+		return 1`)
+	// KEYS: delayed, ready; ARGV: now, limit
+	jobPromoteScript = redis.NewScript(`
+		local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+		for _, id in ipairs(ids) do
+			redis.call('ZREM', KEYS[1], id)
+			redis.call('LPUSH', KEYS[2], id)
+		end
+		return #ids`)
+)
+
+// ProcessNext waits up to PollTimeout for a job and runs it. It reports
+// whether a job was taken. Cancelling ctx stops the wait; a job already taken
+// runs to the end of its timeout and is settled regardless.
+func (q *JobQueue) ProcessNext(ctx context.Context) (bool, error) {
+	id, err := q.rdb.BLMove(ctx, q.key("ready"), q.key("processing"), "RIGHT", "LEFT", q.PollTimeout).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Shutting down must not leave the job in processing until its lease
+	// expires, with the interrupted run counted as an attempt
+	ctx = context.WithoutCancel(ctx)
+
+	// Leased with the default timeout until the job type is known
+	lease := func(d time.Duration) error {
+		return q.rdb.ZAdd(ctx, q.key("leases"), redis.Z{Score: float64(time.Now().Add(d).UnixMilli()), Member: id}).Err()
+	}
+	if err := lease(DefaultJobVisibilityTimeout); err != nil {
+		return true, err
+	}
+	data, err := q.rdb.HGet(ctx, q.key("data"), id).Bytes()
+	if err == redis.Nil {
+		// Deleted while queued
+		return true, q.settle(ctx, jobDropScript, "", id)
+	}
+	if err != nil {
+		return true, err
+	}
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		log.Printf("Job %s: dropping undecodable job: %v", id, err)
+		return true, q.settle(ctx, jobDropScript, "", id)
+	}
+
+	parked, err := jobParkScript.Run(ctx, q.rdb,
+		[]string{q.key("processing"), q.key("leases"), q.key("paused"), q.parkedKey(job.Type)}, id, job.Type).Int()
+	if err != nil {
+		return true, err
+	}
+	if parked == 1 {
+		return true, nil
+	}
+
+	job.Attempts++
+	h, ok := q.handler(job.Type)
+	switch {
+	case !ok:
+		job.LastError = "no handler for job type " + job.Type
+		return true, q.bury(ctx, &job)
+	case job.Attempts > job.MaxAttempts:
+		// Its last attempt never finished
+		job.LastError = "timed out"
+		return true, q.bury(ctx, &job)
+	}
+	if h.opts.Timeout != DefaultJobVisibilityTimeout {
+		if err := lease(h.opts.Timeout); err != nil {
+			return true, err
+		}
+	}
+	// Counted before it runs, so attempts that crash the worker count too
+	started := time.Now().UTC()
+	job.StartedAt = &started
+	encoded, _ := json.Marshal(job)
+	if err := q.rdb.HSet(ctx, q.key("data"), id, encoded).Err(); err != nil {
+		return true, err
+	}
+	if job.Attempts == 1 {
+		jobWait.WithLabelValues(job.Type).Observe(started.Sub(job.EnqueuedAt).Seconds())
+	}
+
+	err = q.run(ctx, h, &job)
+	finished := time.Now().UTC()
+	var permanent permanentJobError
+	switch {
+	case err == nil:
+		jobDuration.WithLabelValues(job.Type, "completed").Observe(finished.Sub(started).Seconds())
+		job.FinishedAt = &finished
+		encoded, _ := json.Marshal(job)
+		return true, q.settle(ctx, jobCompleteScript, "completed", id, encoded, CompletedJobsKept)
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		jobDuration.WithLabelValues(job.Type, "failed").Observe(finished.Sub(started).Seconds())
+		log.Printf("Job %s (%s) failed for good after %d attempts: %v", id, job.Type, job.Attempts, err)
+		job.LastError = err.Error()
+		return true, q.bury(ctx, &job)
+	default:
+		jobDuration.WithLabelValues(job.Type, "retry").Observe(finished.Sub(started).Seconds())
+		delay := q.Backoff(job.Attempts)
+		log.Printf("Job %s (%s) attempt %d failed, retrying in %s: %v", id, job.Type, job.Attempts, delay, err)
+		job.LastError = err.Error()
+		encoded, _ := json.Marshal(job)
+		return true, q.settle(ctx, jobRetryScript, "delayed", id, encoded, time.Now().Add(delay).UnixMilli())
+	}
 }
 
-func ProcessJobs() {
-	for {
-		job, _ := redisClient.BRPop(context.Background(), 0, "jobs").Result()
-		if len(job) > 1 {
-			fmt.Println("Processing job:", job[1]) //Simulate email or log
+// run calls the handler within the job's timeout, turning a panic into an error
+func (q *JobQueue) run(ctx context.Context, h jobHandler, job *models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
+	}()
+	return h.run(ctx, job)
+}
+
+func (q *JobQueue) bury(ctx context.Context, job *models.Job) error {
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	encoded, _ := json.Marshal(job)
+	return q.settle(ctx, jobBuryScript, "dead", job.ID, encoded)
+}
+
+// settle runs one of the scripts taking id off the processing list, with
+// the list the job moves to, if any. If the lease had expired and the job
+// was handed over, nothing changes.
+func (q *JobQueue) settle(ctx context.Context, script *redis.Script, to string, id string, args ...interface{}) error {
+	keys := []string{q.key("processing"), q.key("leases"), q.key("data")}
+	if to != "" {
+		keys = append(keys, q.key(to))
+	}
+	n, err := script.Run(ctx, q.rdb, keys, append([]interface{}{id}, args...)...).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		log.Printf("Job %s: lease expired before it finished; another worker has it", id)
+	}
+	return nil
+}
+
+// Maintain moves retries that are due to the ready list, and jobs whose
+// lease expired back to it, and updates the queue depth gauge. Run calls it
+// every second.
+func (q *JobQueue) Maintain(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	if err := jobPromoteScript.Run(ctx, q.rdb, []string{q.key("delayed"), q.key("ready")}, now, jobPromoteBatch).Err(); err != nil {
+		return err
+	}
+
+	expired, err := q.rdb.ZRangeByScore(ctx, q.key("leases"), &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now, 10)}).Result()
+	if err != nil {
+		return err
+	}
+	processing, err := q.rdb.LRange(ctx, q.key("processing"), 0, -1).Result()
+	if err != nil {
+		return err
 	}
+	unleased := make(map[string]bool)
+	for _, id := range processing {
+		if err := q.rdb.ZScore(ctx, q.key("leases"), id).Err(); err == redis.Nil {
+			if q.unleased[id] {
+				expired = append(expired, id)
+			} else {
+				unleased[id] = true
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	q.unleased = unleased
+
+	for _, id := range expired {
+		n, err := jobRequeueScript.Run(ctx, q.rdb, []string{q.key("processing"), q.key("leases"), q.key("ready")}, id).Int()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Job %s: lease expired, requeued", id)
+		}
+	}
+
+	counts, err := q.Counts(ctx)
+	if err != nil {
+		return err
+	}
+	for state, n := range counts {
+		jobQueueDepth.WithLabelValues(state).Set(float64(n))
+	}
+	return nil
+}
+
+// Run starts Concurrency workers and the maintenance loop, and returns once
+// ctx is done and running jobs have finished and been settled.
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(jobMaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := q.Maintain(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Job queue maintenance failed: %v", err)
+			}
+		}
+	}()
+	for i := 0; i < q.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if _, err := q.ProcessNext(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Job worker error: %v", err)
+					select {
+					case <-ctx.Done():
+					case <-time.After(time.Second):
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// jobQueue is set once StartJobs has connected to Redis
+var jobQueue atomic.Pointer[JobQueue]
+
+// DefaultJobQueue returns the queue run by StartJobs, or nil without Redis
+func DefaultJobQueue() *JobQueue {
+	return jobQueue.Load()
+}
+
+// QueueJob adds a job to the default queue
+func QueueJob(ctx context.Context, jobType string, payload interface{}) (string, error) {
+	q := jobQueue.Load()
+	if q == nil {
+		return "", ErrJobQueueUnavailable
+	}
+	return q.Enqueue(ctx, jobType, payload)
+}
+
+func registerJobHandlers(q *JobQueue) {
+	HandleJob(q, JobSendEmail, JobOptions{Timeout: time.Minute}, func(ctx context.Context, p SendEmailJob) error {
+		return sendEmail(p.To, p.Subject, p.Message)
+	})
+}
+
+// StartJobs runs the default job queue's workers until ctx is done. Set
+// JOB_CONCURRENCY to change the number of workers per instance.
+func StartJobs(ctx context.Context) {
+	rdb := InitRedis()
+	if rdb == nil {
+		log.Println("Redis not available; job queue disabled")
+		return
+	}
+	q := NewJobQueue(rdb, "jobs")
+	if v := os.Getenv("JOB_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			q.Concurrency = n
+		} else {
+			log.Printf("Ignoring invalid JOB_CONCURRENCY %q", v)
+		}
+	}
+	registerJobHandlers(q)
+	jobQueue.Store(q)
+	defer jobQueue.Store(nil)
+
+	log.Printf("Starting job queue with %d workers", q.Concurrency)
+	q.Run(ctx)
 }
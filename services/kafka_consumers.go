@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaConsumerStats is a snapshot of one of this replica's Kafka consumers
+type KafkaConsumerStats struct {
+	Name   string `json:"name"`
+	Topic  string `json:"topic"`
+	Group  string `json:"group"`
+	Offset int64  `json:"offset"`
+	Lag    int64  `json:"lag"`
+}
+
+var kafkaConsumers sync.Map // name -> *kafka.Reader
+
+// trackKafkaConsumer adds r to the admin dashboard and the
+// kafka_consumer_lag metric until the returned func is called
+func trackKafkaConsumer(name string, r *kafka.Reader) func() {
+	kafkaConsumers.Store(name, r)
+	return func() { kafkaConsumers.Delete(name) }
+}
+
+// KafkaConsumers returns the running Kafka consumers, sorted by name
+func KafkaConsumers() []KafkaConsumerStats {
+	consumers := []KafkaConsumerStats{}
+	kafkaConsumers.Range(func(k, v interface{}) bool {
+		r := v.(*kafka.Reader)
+		s := r.Stats()
+		consumers = append(consumers, KafkaConsumerStats{
+			Name:   k.(string),
+			Topic:  s.Topic,
+			Group:  r.Config().GroupID,
+			Offset: s.Offset,
+			Lag:    s.Lag,
+		})
+		return true
+	})
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+var kafkaLagDesc = prometheus.NewDesc("kafka_consumer_lag", "Messages a Kafka consumer has yet to read", []string{"consumer"}, nil)
+
+type kafkaLagCollector struct{}
+
+func (kafkaLagCollector) Describe(ch chan<- *prometheus.Desc) { ch <- kafkaLagDesc }
+
+func (kafkaLagCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range KafkaConsumers() {
+		ch <- prometheus.MustNewConstMetric(kafkaLagDesc, prometheus.GaugeValue, float64(c.Lag), c.Name)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(kafkaLagCollector{})
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	defaultChatHistoryRetention = 90 * 24 * time.Hour
+	defaultRequestLogRetention  = 30 * 24 * time.Hour
+	sentOutboxRetention         = 7 * 24 * time.Hour
+	cronRunRetention            = 30 * 24 * time.Hour
+	purgeBatch                  = 1000
+)
+
+// retentionFromEnv reads a retention period such as "720h" from name. "0"
+// keeps everything, returned as 0.
+func retentionFromEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid %s %q", name, v)
+		return def
+	}
+	return d
+}
+
+// ChatHistoryRetention is how long chat messages are kept; set
+// CHAT_HISTORY_RETENTION to change the 90 day default, or to 0 to keep them
+func ChatHistoryRetention() time.Duration {
+	return retentionFromEnv("CHAT_HISTORY_RETENTION", defaultChatHistoryRetention)
+}
+
+// RequestLogRetention is how long request logs are kept; set
+// REQUEST_LOG_RETENTION to change the 30 day default, or to 0 to keep them
+func RequestLogRetention() time.Duration {
+	return retentionFromEnv("REQUEST_LOG_RETENTION", defaultRequestLogRetention)
+}
+
+// purgeOlderThan deletes rows of table whose column is older than age, in
+// batches so no single statement holds locks for long. table and column are
+// never user input.
+func purgeOlderThan(ctx context.Context, table, column string, age time.Duration) (int64, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	var total int64
+	for {
+		tag, err := DB().Exec(ctx, `
+			DELETE FROM `+table+` WHERE id IN (
+				SELECT id FROM `+table+` WHERE `+column+` < now() - $1::interval LIMIT $2)`,
+			age.String(), purgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < purgeBatch {
+			return total, nil
+		}
+	}
+}
+
+// PurgeExpiredSanctions deletes mutes and bans that have run out
+func PurgeExpiredSanctions(ctx context.Context) (int64, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx, "DELETE FROM chat_room_sanctions WHERE expires_at <= now()")
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// purgeJob adapts a purge to a cron job that logs what it removed
+func purgeJob(what string, purge func(ctx context.Context) (int64, error)) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := purge(ctx)
+		if n > 0 {
+			log.Printf("Purged %d %s", n, what)
+		}
+		return err
+	}
+}
+
+func olderThan(table, column string, age time.Duration) func(ctx context.Context) (int64, error) {
+	return func(ctx context.Context) (int64, error) {
+		return purgeOlderThan(ctx, table, column, age)
+	}
+}
+
+type maintenanceJob struct {
+	name, spec string
+	run        func(ctx context.Context) error
+}
+
+// registerMaintenanceJobs adds the periodic maintenance jobs. Times are UTC;
+// the daily purges are spread over the early morning.
+func registerMaintenanceJobs(c *Cron) {
+	jobs := []maintenanceJob{
+		{"send-digests", "* * * * *", SendDueDigests},
+		{"purge-inbox", "@hourly", purgeJob("expired inbox items", PurgeExpiredInbox)},
+		{"purge-sanctions", "*/15 * * * *", purgeJob("expired chat sanctions", PurgeExpiredSanctions)},
+		{"purge-outbox", "30 3 * * *", purgeJob("sent outbox rows", olderThan("outbox", "sent_at", sentOutboxRetention))},
+		{"purge-cron-runs", "0 5 * * *", purgeJob("cron runs", olderThan("cron_runs", "started_at", cronRunRetention))},
+	}
+	if r := ChatHistoryRetention(); r > 0 {
+		jobs = append(jobs, maintenanceJob{"purge-chat-history", "0 4 * * *",
+			purgeJob("old chat messages", olderThan("chat_messages", "created_at", r))})
+	}
+	if r := RequestLogRetention(); r > 0 {
+		jobs = append(jobs, maintenanceJob{"purge-request-logs", "30 4 * * *",
+			purgeJob("old request logs", olderThan("request_logs", "time", r))})
+	}
+	for _, j := range jobs {
+		if err := c.Register(j.name, j.spec, j.run); err != nil {
+			log.Printf("Cron job %s not registered: %v", j.name, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMuted               = errors.New("muted in this room")
+	ErrBanned              = errors.New("banned from this room")
+	ErrSanctionNotFound    = errors.New("sanction not found")
+	ErrMessageNotFound     = errors.New("message not found")
+	ErrAlreadyReported     = errors.New("message already reported")
+	ErrReportNotFound      = errors.New("report not found")
+	ErrInvalidSanction     = errors.New("kind must be mute or ban")
+	ErrInvalidReportStatus = errors.New("status must be dismissed or actioned")
+)
+
+// SanctionUser mutes or bans a user in a room, replacing an earlier sanction
+// of the same kind. A ban also removes the user from the room, including
+// their open connections.
+func SanctionUser(ctx context.Context, s *models.RoomSanction) error {
+	if s.Kind != models.SanctionMute && s.Kind != models.SanctionBan {
+		return ErrInvalidSanction
+	}
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	err := DB().QueryRow(ctx, `
+		INSERT INTO chat_room_sanctions (room, user_id, kind, reason, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (room, user_id, kind) DO UPDATE
+		SET reason = EXCLUDED.reason, created_by = EXCLUDED.created_by, created_at = now(), expires_at = EXCLUDED.expires_at
+		RETURNING created_at`,
+		s.Room, s.UserID, s.Kind, s.Reason, s.CreatedBy, s.ExpiresAt).Scan(&s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if s.Kind == models.SanctionBan {
+		return RemoveRoomMember(ctx, s.Room, s.UserID)
+	}
+	return nil
+}
+
+// LiftSanction removes a mute or ban
+func LiftSanction(ctx context.Context, room string, userID int, kind string) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx,
+		"DELETE FROM chat_room_sanctions WHERE room = $1 AND user_id = $2 AND kind = $3", room, userID, kind)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSanctionNotFound
+	}
+	return nil
+}
+
+// ListSanctions returns a room's unexpired mutes and bans
+func ListSanctions(ctx context.Context, room string) ([]models.RoomSanction, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT room, user_id, kind, reason, created_by, created_at, expires_at
+		FROM chat_room_sanctions
+		WHERE room = $1 AND (expires_at IS NULL OR expires_at > now())
+		ORDER BY created_at DESC`, room)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sanctions := []models.RoomSanction{}
+	for rows.Next() {
+		var s models.RoomSanction
+		if err := rows.Scan(&s.Room, &s.UserID, &s.Kind, &s.Reason, &s.CreatedBy, &s.CreatedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+// CheckSanctions returns ErrBanned or ErrMuted when userID is banned or muted
+// in room, ErrBanned taking precedence
+func CheckSanctions(ctx context.Context, room string, userID int) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT kind FROM chat_room_sanctions
+		WHERE room = $1 AND user_id = $2 AND (expires_at IS NULL OR expires_at > now())`, room, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var muted bool
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return err
+		}
+		switch kind {
+		case models.SanctionBan:
+			return ErrBanned
+		case models.SanctionMute:
+			muted = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if muted {
+		return ErrMuted
+	}
+	return nil
+}
+
+// ReportMessage files userID's report of a chat message they can see: a
+// direct message they sent or received, or a message in a room they may
+// join.
+func ReportMessage(ctx context.Context, userID int, role string, messageID int64, reason string) (*models.ChatReport, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, "SELECT "+chatMessageColumns+" FROM chat_messages WHERE id = $1", messageID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanChatMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	m := messages[0]
+	if m.Room != "" {
+		room, err := GetRoom(ctx, m.Room)
+		if err != nil {
+			return nil, err
+		}
+		memberRole, err := RoomMemberRole(ctx, m.Room, userID)
+		if err != nil {
+			return nil, err
+		}
+		if AuthorizeRoomJoin(room, role, memberRole != "") != nil {
+			return nil, ErrMessageNotFound
+		}
+	} else if m.From != userID && m.To != userID {
+		return nil, ErrMessageNotFound
+	}
+
+	report := &models.ChatReport{
+		MessageID:  messageID,
+		Room:       m.Room,
+		SenderID:   m.From,
+		Message:    m.Message,
+		ReporterID: userID,
+		Reason:     reason,
+		Status:     models.ReportOpen,
+	}
+	err = DB().QueryRow(ctx, `
+		INSERT INTO chat_reports (message_id, room, sender_id, message, reporter_id, reason)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		ON CONFLICT (message_id, reporter_id) DO NOTHING
+		RETURNING id, created_at`,
+		messageID, m.Room, m.From, m.Message, userID, reason).Scan(&report.ID, &report.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlreadyReported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListReports returns up to limit reports with the given status (all when
+// empty), newest first, starting before the given report ID (0 for the newest)
+func ListReports(ctx context.Context, status string, before int64, limit int) ([]models.ChatReport, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT id, message_id, COALESCE(room, ''), sender_id, message, reporter_id, reason, status,
+			created_at, COALESCE(reviewed_by, 0), reviewed_at
+		FROM chat_reports
+		WHERE ($1 = '' OR status = $1) AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC LIMIT $3`, status, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reports := []models.ChatReport{}
+	for rows.Next() {
+		var r models.ChatReport
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.Room, &r.SenderID, &r.Message, &r.ReporterID, &r.Reason,
+			&r.Status, &r.CreatedAt, &r.ReviewedBy, &r.ReviewedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ReviewReport closes a report as dismissed or actioned
+func ReviewReport(ctx context.Context, id int64, reviewerID int, status string) error {
+	if status != models.ReportDismissed && status != models.ReportActioned {
+		return ErrInvalidReportStatus
+	}
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx, `
+		UPDATE chat_reports SET status = $2, reviewed_by = $3, reviewed_at = now()
+		WHERE id = $1`, id, status, reviewerID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"user-notification-api/models"
+
+	pb "user-notification-api/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize   = 50
+	maxPageSize       = 500
+	watchPollInterval = 500 * time.Millisecond
+)
+
+// NotificationServer implements the gRPC NotificationService
+type NotificationServer struct {
+	pb.UnimplementedNotificationServiceServer
+}
+
+func toProtoNotification(n *models.Notification) *pb.Notification {
+	return &pb.Notification{
+		Id:        n.ID,
+		Email:     n.Email,
+		Subject:   n.Subject,
+		Message:   n.Message,
+		Category:  n.Category,
+		Priority:  n.Priority,
+		Status:    n.Status,
+		Error:     n.Error,
+		SendAt:    timestamppb.New(n.SendAt),
+		CreatedAt: timestamppb.New(n.CreatedAt),
+		UpdatedAt: timestamppb.New(n.UpdatedAt),
+	}
+}
+
+// notificationError maps service errors to gRPC status codes
+func notificationError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, ErrNotificationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotificationNotCancellable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// callerScope is NotificationScope for the caller of an RPC
+func callerScope(ctx context.Context) (int, error) {
+	p, _ := PrincipalFromContext(ctx)
+	scope, err := NotificationScope(p)
+	if err != nil {
+		return 0, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return scope, nil
+}
+
+// visibleNotification loads a notification the caller is allowed to see
+func visibleNotification(ctx context.Context, id int64) (*models.Notification, error) {
+	scope, err := callerScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := GetNotification(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if scope != 0 && n.CreatedBy != scope {
+		return nil, ErrNotificationNotFound
+	}
+	return n, nil
+}
+
+// enqueue stores one notification for the scheduler to release
+func enqueue(ctx context.Context, n *models.Notification) *pb.NotificationResponse {
+	if n.Email == "" {
+		return &pb.NotificationResponse{Success: false, Error: "email is required"}
+	}
+	category, err := NormalizeCategory(n.Category)
+	if err != nil {
+		return &pb.NotificationResponse{Success: false, Error: err.Error()}
+	}
+	n.Category = category
+	if p, ok := PrincipalFromContext(ctx); ok {
+		n.CreatedBy, n.CreatedByName = p.UserID, p.Name
+	}
+	duplicate, err := ScheduleNotification(ctx, n)
+	if err != nil {
+		log.Printf("gRPC enqueue failed for %s: %v", n.Email, err)
+		return &pb.NotificationResponse{Success: false, Error: err.Error()}
+	}
+	return &pb.NotificationResponse{Success: true, Duplicate: duplicate, Id: n.ID, Status: n.Status}
+}
+
+func (s *NotificationServer) SendNotification(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
+	n := &models.Notification{
+		Email:          req.Email,
+		Category:       req.Category,
+		Priority:       req.Priority,
+		Subject:        req.Subject,
+		Message:        req.Message,
+		IdempotencyKey: req.IdempotencyKey,
+	}
+	if req.SendAt != nil {
+		n.SendAt = req.SendAt.AsTime()
+	}
+	resp := enqueue(ctx, n)
+	if resp.Success {
+		log.Printf("gRPC queued notification %d for %s", resp.Id, req.Email)
+	}
+	return resp, nil
+}
+
+func (s *NotificationServer) GetNotification(ctx context.Context, req *pb.GetNotificationRequest) (*pb.Notification, error) {
+	n, err := visibleNotification(ctx, req.Id)
+	if err != nil {
+		return nil, notificationError(err)
+	}
+	return toProtoNotification(n), nil
+}
+
+func (s *NotificationServer) ListNotifications(ctx context.Context, req *pb.ListNotificationsRequest) (*pb.ListNotificationsResponse, error) {
+	scope, err := callerScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := NotificationFilter{Email: req.Email, Status: req.Status, CreatedBy: scope, Limit: int(req.PageSize)}
+	if f.Limit <= 0 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+	if req.PageToken != "" {
+		after, err := strconv.ParseInt(req.PageToken, 10, 64)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		f.AfterID = after
+	}
+
+	list, err := ListNotifications(ctx, f)
+	if err != nil {
+		return nil, notificationError(err)
+	}
+	resp := &pb.ListNotificationsResponse{}
+	for _, n := range list {
+		resp.Notifications = append(resp.Notifications, toProtoNotification(n))
+	}
+	if len(list) == f.Limit {
+		resp.NextPageToken = strconv.FormatInt(list[len(list)-1].ID, 10)
+	}
+	return resp, nil
+}
+
+func (s *NotificationServer) CancelNotification(ctx context.Context, req *pb.CancelNotificationRequest) (*pb.Notification, error) {
+	if _, err := visibleNotification(ctx, req.Id); err != nil {
+		return nil, notificationError(err)
+	}
+	if err := CancelNotification(ctx, req.Id); err != nil {
+		return nil, notificationError(err)
+	}
+	return s.GetNotification(ctx, &pb.GetNotificationRequest{Id: req.Id})
+}
+
+func (s *NotificationServer) SendBatch(ctx context.Context, req *pb.SendBatchRequest) (*pb.SendBatchResponse, error) {
+	if len(req.Emails) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "emails is required")
+	}
+	if len(req.Emails) > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d emails per batch", maxPageSize)
+	}
+	resp := &pb.SendBatchResponse{}
+	for _, email := range req.Emails {
+		n := &models.Notification{
+			Email:    email,
+			Category: req.Category,
+			Priority: req.Priority,
+			Subject:  req.Subject,
+			Message:  req.Message,
+		}
+		if req.IdempotencyKey != "" {
+			n.IdempotencyKey = req.IdempotencyKey + ":" + email
+		}
+		if req.SendAt != nil {
+			n.SendAt = req.SendAt.AsTime()
+		}
+		resp.Results = append(resp.Results, enqueue(ctx, n))
+	}
+	log.Printf("gRPC queued batch of %d notifications", len(req.Emails))
+	return resp, nil
+}
+
+// WatchStatus polls the notification records and streams every change
+func (s *NotificationServer) WatchStatus(req *pb.WatchStatusRequest, stream grpc.ServerStreamingServer[pb.StatusUpdate]) error {
+	if len(req.Ids) == 0 {
+		return status.Error(codes.InvalidArgument, "ids is required")
+	}
+	ctx := stream.Context()
+	last := make(map[int64]string, len(req.Ids))
+	pending := make(map[int64]bool, len(req.Ids))
+	for _, id := range req.Ids {
+		pending[id] = true
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		for id := range pending {
+			n, err := visibleNotification(ctx, id)
+			if err != nil {
+				return notificationError(err)
+			}
+			if n.Status != last[id] {
+				last[id] = n.Status
+				err := stream.Send(&pb.StatusUpdate{
+					Id:        n.ID,
+					Status:    n.Status,
+					Error:     n.Error,
+					UpdatedAt: timestamppb.New(n.UpdatedAt),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if n.IsFinal() {
+				delete(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
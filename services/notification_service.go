@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	schedulerPollInterval = time.Second
+	schedulerBatchSize    = 100
+)
+
+var (
+	ErrNotificationNotFound       = errors.New("notification not found")
+	ErrNotificationNotCancellable = errors.New("notification is no longer scheduled")
+	ErrNotificationAccessDenied   = errors.New("caller cannot read notifications")
+)
+
+// NotificationScope returns the user whose notifications p may see and
+// cancel, or 0 for admins and services, which may see every notification.
+// Other callers without a user, such as API keys with a custom role, are
+// denied. HTTP and gRPC handlers both use it.
+func NotificationScope(p *Principal) (int, error) {
+	switch {
+	case p == nil:
+		return 0, ErrNotificationAccessDenied
+	case p.Role == "admin" || p.Role == "service":
+		return 0, nil
+	case p.UserID == 0:
+		return 0, ErrNotificationAccessDenied
+	}
+	return p.UserID, nil
+}
+
+const notificationColumns = `id, COALESCE(user_id, 0), email, category, priority, subject, message, COALESCE(idempotency_key, ''), status,
+	send_at, COALESCE(error, ''), COALESCE(created_by, 0), created_by_name, created_at, updated_at`
+
+func scanNotification(row pgx.Row) (*models.Notification, error) {
+	var n models.Notification
+	err := row.Scan(&n.ID, &n.UserID, &n.Email, &n.Category, &n.Priority, &n.Subject, &n.Message, &n.IdempotencyKey, &n.Status,
+		&n.SendAt, &n.Error, &n.CreatedBy, &n.CreatedByName, &n.CreatedAt, &n.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ScheduleNotification stores a notification to be released at n.SendAt (now
+// if zero). Idempotency keys belong to the creator, n.CreatedBy or for API
+// keys and certificates n.CreatedByName: repeating one returns that creator's
+// original notification and duplicate=true instead of scheduling a second
+// one, while the same key from another creator is a new notification.
+// n.Status defaults to scheduled; digest stores it for the user's next digest
+// instead.
+func ScheduleNotification(ctx context.Context, n *models.Notification) (duplicate bool, err error) {
+	if DB() == nil {
+		return false, errors.New("database not available")
+	}
+	if n.SendAt.IsZero() {
+		n.SendAt = time.Now()
+	}
+	if n.Category == "" {
+		n.Category = models.CategoryGeneral
+	}
+	if n.Priority == "" {
+		n.Priority = models.PriorityNormal
+	}
+	if n.Status == "" {
+		n.Status = models.NotificationScheduled
+	}
+	err = DB().QueryRow(ctx, `
+		INSERT INTO notifications (user_id, email, category, priority, subject, message, idempotency_key, send_at, created_by, created_by_name, status)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, NULLIF($7, ''), $8, NULLIF($9, 0), $10, $11)
+		ON CONFLICT ((COALESCE(created_by, 0)), created_by_name, idempotency_key) DO NOTHING
+		RETURNING id, status, created_at, updated_at`,
+		n.UserID, n.Email, n.Category, n.Priority, n.Subject, n.Message, n.IdempotencyKey, n.SendAt, n.CreatedBy, n.CreatedByName, n.Status,
+	).Scan(&n.ID, &n.Status, &n.CreatedAt, &n.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		existing, err := scanNotification(DB().QueryRow(ctx,
+			"SELECT "+notificationColumns+" FROM notifications WHERE COALESCE(created_by, 0) = $1 AND created_by_name = $2 AND idempotency_key = $3",
+			n.CreatedBy, n.CreatedByName, n.IdempotencyKey))
+		if err != nil {
+			return false, err
+		}
+		*n = *existing
+		return true, nil
+	}
+	return false, err
+}
+
+// GetNotification loads a notification by ID
+func GetNotification(ctx context.Context, id int64) (*models.Notification, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	return scanNotification(DB().QueryRow(ctx,
+		"SELECT "+notificationColumns+" FROM notifications WHERE id = $1", id))
+}
+
+// NotificationFilter selects notifications for ListNotifications
+type NotificationFilter struct {
+	Email     string
+	Status    string
+	CreatedBy int
+	// AfterID is the pagination cursor: only IDs greater than it are returned
+	AfterID int64
+	Limit   int
+}
+
+// ListNotifications returns notifications matching the filter in ID order
+func ListNotifications(ctx context.Context, f NotificationFilter) ([]*models.Notification, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE id > $1
+		AND ($2 = '' OR email = $2)
+		AND ($3 = '' OR status = $3)
+		AND ($4 = 0 OR created_by = $4)
+		ORDER BY id LIMIT $5`,
+		f.AfterID, f.Email, f.Status, f.CreatedBy, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+// CancelNotification cancels a notification that has not been released yet
+func CancelNotification(ctx context.Context, id int64) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	tag, err := DB().Exec(ctx, `
+		UPDATE notifications SET status = $2, updated_at = now()
+		WHERE id = $1 AND status = $3`,
+		id, models.NotificationCancelled, models.NotificationScheduled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := GetNotification(ctx, id); err != nil {
+			return err
+		}
+		return ErrNotificationNotCancellable
+	}
+	return nil
+}
+
+// setNotificationStatus records the outcome of a delivery attempt
+func setNotificationStatus(ctx context.Context, id int64, status, errMsg string) {
+	if DB() == nil {
+		return
+	}
+	_, err := DB().Exec(ctx, `
+		UPDATE notifications SET status = $2, error = NULLIF($3, ''), updated_at = now()
+		WHERE id = $1`, id, status, errMsg)
+	if err != nil {
+		log.Printf("Failed to update notification %d status: %v", id, err)
+	}
+}
+
+// StartScheduler releases due notifications into the outbox until ctx is
+// done. Due rows are claimed with SKIP LOCKED and moved to queued in the same
+// transaction as their outbox row, so each is released once across replicas.
+func StartScheduler(ctx context.Context) {
+	log.Println("Starting notification scheduler")
+	ticker := time.NewTicker(schedulerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if DB() == nil {
+			continue
+		}
+		for {
+			n, err := releaseDueNotifications(ctx)
+			if err != nil {
+				log.Printf("Scheduler error: %v", err)
+				break
+			}
+			if n < schedulerBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func releaseDueNotifications(ctx context.Context) (int, error) {
+	tx, err := DB().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE status = $1 AND send_at <= now()
+		ORDER BY send_at LIMIT $2
+		FOR UPDATE SKIP LOCKED`, models.NotificationScheduled, schedulerBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var due []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, n := range due {
+		msg := RegistrationMessage{
+			Email:          n.Email,
+			Subject:        n.Subject,
+			Message:        n.Message,
+			IdempotencyKey: fmt.Sprintf("notification:%d", n.ID),
+			NotificationID: n.ID,
+			CreatedBy:      n.CreatedBy,
+			CreatedByName:  n.CreatedByName,
+			UserID:         n.UserID,
+			Category:       n.Category,
+			Priority:       n.Priority,
+		}
+		if err := EnqueueOutbox(ctx, tx, RegistrationTopic, n.Email, msg); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx,
+			"UPDATE notifications SET status = $2, updated_at = now() WHERE id = $1",
+			n.ID, models.NotificationQueued); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if len(due) > 0 {
+		log.Printf("Released %d scheduled notifications", len(due))
+	}
+	return len(due), nil
+}
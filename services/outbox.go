@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	// outboxClaimLease is how long claimed rows are left to one relay
+	outboxClaimLease = time.Minute
+)
+
+var (
+	outboxPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_pending_messages",
+			Help: "Number of outbox rows not yet published to Kafka",
+		},
+	)
+	outboxLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_lag_seconds",
+			Help: "Age of the oldest unpublished outbox row",
+		},
+	)
+	outboxPublished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_published_total",
+			Help: "Outbox rows published to Kafka",
+		},
+		[]string{"status"}, // Success or failure
+	)
+)
+
+func init() {
+	prometheus.MustRegister(outboxPending, outboxLag, outboxPublished)
+}
+
+// Execer is satisfied by both the pool and a pgx.Tx
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// EnqueueOutbox stores a Kafka message to be published by the relay. Pass the
+// transaction that writes the related rows so both commit or neither does.
+func EnqueueOutbox(ctx context.Context, exec Execer, topic, key string, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(ctx,
+		"INSERT INTO outbox (topic, key, payload) VALUES ($1, $2, $3)",
+		topic, key, payload)
+	return err
+}
+
+// OutboxMessage is an outbox row waiting to be published
+type OutboxMessage struct {
+	ID      int64
+	Topic   string
+	Key     string
+	Payload []byte
+}
+
+// OutboxStore hands out pending outbox rows. Claim leases up to limit rows to
+// the caller, so other relays skip them until the lease runs out; MarkSent
+// records rows as published and Release returns them to be claimed again.
+type OutboxStore interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, ids []int64) error
+	Release(ctx context.Context, ids []int64) error
+}
+
+// StartOutboxRelay publishes pending outbox rows to Kafka until ctx is done.
+// Rows are claimed with a lease so several replicas can relay in parallel.
+func StartOutboxRelay(ctx context.Context) {
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(kafkaBroker()),
+		Balancer: &kafka.LeastBytes{},
+	}
+	defer writer.Close()
+
+	log.Println("Starting outbox relay")
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if DB() == nil {
+			continue
+		}
+		for {
+			n, err := RelayOutbox(ctx, PostgresOutbox{}, writer)
+			if err != nil {
+				log.Printf("Outbox relay error: %v", err)
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+		updateOutboxMetrics(ctx)
+	}
+}
+
+// RelayOutbox publishes one batch of claimed rows and returns how many were
+// sent. No transaction or row lock is held while Kafka is written to: rows
+// that fail to publish are released for the next poll, and rows claimed by a
+// relay that crashed are retried once their lease runs out.
+func RelayOutbox(ctx context.Context, store OutboxStore, writer KafkaWriterInterface) (int, error) {
+	claimed, err := store.Claim(ctx, outboxBatchSize, outboxClaimLease)
+	if err != nil {
+		return 0, err
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+	ids := make([]int64, len(claimed))
+	msgs := make([]kafka.Message, len(claimed))
+	for i, m := range claimed {
+		ids[i] = m.ID
+		msgs[i] = kafka.Message{Topic: m.Topic, Key: []byte(m.Key), Value: m.Payload}
+	}
+
+	// Give up well before the lease ends so no other relay publishes the
+	// batch while this one still might
+	writeCtx, cancel := context.WithTimeout(ctx, outboxClaimLease/2)
+	err = writer.WriteMessages(writeCtx, msgs...)
+	cancel()
+	if err != nil {
+		outboxPublished.WithLabelValues("failure").Add(float64(len(msgs)))
+		if relErr := store.Release(ctx, ids); relErr != nil {
+			log.Printf("Failed to release %d outbox rows: %v", len(ids), relErr)
+		}
+		return 0, err
+	}
+	outboxPublished.WithLabelValues("success").Add(float64(len(msgs)))
+
+	// A crash before this update republishes the batch once the lease runs
+	// out; consumers deduplicate with the message idempotency key.
+	if err := store.MarkSent(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
+}
+
+// PostgresOutbox claims rows from the outbox table
+type PostgresOutbox struct{}
+
+func (PostgresOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		UPDATE outbox SET claimed_until = now() + $2::float8 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND (claimed_until IS NULL OR claimed_until < now())
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, topic, COALESCE(key, ''), payload`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var claimed []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the subquery's order
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID < claimed[j].ID })
+	return claimed, nil
+}
+
+func (PostgresOutbox) MarkSent(ctx context.Context, ids []int64) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	_, err := DB().Exec(ctx, "UPDATE outbox SET sent_at = now(), claimed_until = NULL WHERE id = ANY($1)", ids)
+	return err
+}
+
+func (PostgresOutbox) Release(ctx context.Context, ids []int64) error {
+	if DB() == nil {
+		return errors.New("database not available")
+	}
+	_, err := DB().Exec(ctx, "UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1) AND sent_at IS NULL", ids)
+	return err
+}
+
+func updateOutboxMetrics(ctx context.Context) {
+	var pending int64
+	var lag float64
+	err := DB().QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(EXTRACT(EPOCH FROM now() - MIN(created_at)), 0)
+		FROM outbox WHERE sent_at IS NULL`).Scan(&pending, &lag)
+	if err != nil {
+		log.Printf("Failed to read outbox metrics: %v", err)
+		return
+	}
+	outboxPending.Set(float64(pending))
+	outboxLag.Set(lag)
+}
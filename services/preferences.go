@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"user-notification-api/models"
+)
+
+// DeliveryDecision is the outcome of checking a user's preferences
+type DeliveryDecision int
+
+const (
+	DeliveryAllow DeliveryDecision = iota
+	DeliverySuppress
+	DeliveryDefer
+)
+
+var (
+	notificationCategories = map[string]bool{
+		models.CategorySecurity:  true,
+		models.CategoryAccount:   true,
+		models.CategoryMarketing: true,
+		models.CategoryGeneral:   true,
+	}
+	notificationChannels = map[string]bool{
+		models.ChannelEmail: true,
+		models.ChannelInApp: true,
+	}
+)
+
+// isMandatoryCategory reports categories users cannot opt out of; they also
+// ignore quiet hours.
+func isMandatoryCategory(category string) bool {
+	return category == models.CategorySecurity
+}
+
+// NormalizeCategory lowercases and trims a requested category, defaulting to
+// general, and rejects unknown ones so they cannot skip the opt-out check
+func NormalizeCategory(category string) (string, error) {
+	c := strings.ToLower(strings.TrimSpace(category))
+	if c == "" {
+		return models.CategoryGeneral, nil
+	}
+	if !notificationCategories[c] {
+		return "", fmt.Errorf("unknown category %q", category)
+	}
+	return c, nil
+}
+
+// ValidatePreferences checks categories, channels and quiet hours
+func ValidatePreferences(prefs *models.NotificationPreferences) error {
+	for _, p := range prefs.Channels {
+		if !notificationCategories[p.Category] {
+			return fmt.Errorf("unknown category %q", p.Category)
+		}
+		if !notificationChannels[p.Channel] {
+			return fmt.Errorf("unknown channel %q", p.Channel)
+		}
+		if isMandatoryCategory(p.Category) && !p.Enabled {
+			return fmt.Errorf("%s notifications cannot be disabled", p.Category)
+		}
+	}
+	switch prefs.DigestFrequency {
+	case "", models.DigestOff, models.DigestHourly, models.DigestDaily:
+	default:
+		return fmt.Errorf("unknown digest frequency %q", prefs.DigestFrequency)
+	}
+	if q := prefs.QuietHours; q != nil {
+		if _, err := parseClock(q.Start); err != nil {
+			return fmt.Errorf("invalid quiet hours start %q", q.Start)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return fmt.Errorf("invalid quiet hours end %q", q.End)
+		}
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", q.Timezone)
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into an offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// QuietUntil reports whether now falls inside the quiet hours and, if so,
+// when they end.
+func QuietUntil(q *models.QuietHours, now time.Time) (bool, time.Time) {
+	if q == nil || q.Start == q.End {
+		return false, time.Time{}
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return false, time.Time{}
+	}
+	start, err1 := parseClock(q.Start)
+	end, err2 := parseClock(q.End)
+	if err1 != nil || err2 != nil {
+		return false, time.Time{}
+	}
+
+	// Compare wall clock times: on days when clocks change, midnight is not
+	// 24 hours from the next one
+	local := now.In(loc)
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	endsOn := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days,
+			int(end/time.Hour), int(end%time.Hour/time.Minute), 0, 0, loc)
+	}
+
+	if start < end {
+		if clock >= start && clock < end {
+			return true, endsOn(0)
+		}
+		return false, time.Time{}
+	}
+	// Window wraps past midnight, e.g. 22:00-07:00
+	if clock >= start {
+		return true, endsOn(1)
+	}
+	if clock < end {
+		return true, endsOn(0)
+	}
+	return false, time.Time{}
+}
+
+// CheckDelivery decides whether a notification may be sent now. For
+// DeliveryDefer the returned time is when quiet hours end.
+func CheckDelivery(prefs *models.NotificationPreferences, category, channel string, now time.Time) (DeliveryDecision, time.Time) {
+	if prefs == nil || isMandatoryCategory(category) {
+		return DeliveryAllow, time.Time{}
+	}
+	for _, p := range prefs.Channels {
+		if p.Category == category && p.Channel == channel && !p.Enabled {
+			return DeliverySuppress, time.Time{}
+		}
+	}
+	if quiet, until := QuietUntil(prefs.QuietHours, now); quiet {
+		return DeliveryDefer, until
+	}
+	return DeliveryAllow, time.Time{}
+}
+
+// UsesDigest reports whether a notification should wait for the user's
+// digest instead of being sent on its own.
+func UsesDigest(prefs *models.NotificationPreferences, category, priority string) bool {
+	if prefs == nil || isMandatoryCategory(category) || priority == models.PriorityHigh {
+		return false
+	}
+	return prefs.DigestFrequency == models.DigestHourly || prefs.DigestFrequency == models.DigestDaily
+}
+
+// GetPreferences loads a user's preferences; users without any stored
+// preferences get everything enabled and no quiet hours.
+func GetPreferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	prefs := &models.NotificationPreferences{Channels: []models.ChannelPreference{}, DigestFrequency: models.DigestOff}
+	if DB() == nil {
+		return prefs, fmt.Errorf("database not available")
+	}
+
+	rows, err := DB().Query(ctx, `
+		SELECT category, channel, enabled FROM notification_preferences
+		WHERE user_id = $1 ORDER BY category, channel`, userID)
+	if err != nil {
+		return prefs, err
+	}
+	for rows.Next() {
+		var p models.ChannelPreference
+		if err := rows.Scan(&p.Category, &p.Channel, &p.Enabled); err != nil {
+			rows.Close()
+			return prefs, err
+		}
+		prefs.Channels = append(prefs.Channels, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return prefs, err
+	}
+
+	var start, end *string
+	var tz, digest string
+	err = DB().QueryRow(ctx, `
+		SELECT quiet_start, quiet_end, timezone, digest_frequency FROM notification_settings WHERE user_id = $1`,
+		userID).Scan(&start, &end, &tz, &digest)
+	if err == nil {
+		prefs.DigestFrequency = digest
+		if start != nil && end != nil {
+			prefs.QuietHours = &models.QuietHours{Start: *start, End: *end, Timezone: tz}
+		}
+	}
+	return prefs, nil
+}
+
+// SavePreferences replaces a user's preferences
+func SavePreferences(ctx context.Context, userID int, prefs *models.NotificationPreferences) error {
+	if err := ValidatePreferences(prefs); err != nil {
+		return err
+	}
+	if DB() == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	tx, err := DB().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM notification_preferences WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, p := range prefs.Channels {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO notification_preferences (user_id, category, channel, enabled)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, category, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			userID, p.Category, p.Channel, p.Enabled)
+		if err != nil {
+			return err
+		}
+	}
+
+	var start, end *string
+	tz := "UTC"
+	if q := prefs.QuietHours; q != nil {
+		start, end, tz = &q.Start, &q.End, q.Timezone
+	}
+	digest := prefs.DigestFrequency
+	if digest == "" {
+		digest = models.DigestOff
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notification_settings (user_id, quiet_start, quiet_end, timezone, digest_frequency)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			timezone = EXCLUDED.timezone, digest_frequency = EXCLUDED.digest_frequency`,
+		userID, start, end, tz, digest)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// userIDByEmail resolves the recipient of an email notification
+func userIDByEmail(ctx context.Context, email string) (int, error) {
+	if DB() == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+	var id int
+	err := DB().QueryRow(ctx, "SELECT id FROM users WHERE email = $1", email).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	presenceHeartbeat = 30 * time.Second
+	// presenceTTL is how long a connection counts without a heartbeat, so
+	// connections of an instance that died expire on their own
+	presenceTTL     = 3 * presenceHeartbeat
+	lastSeenTTL     = 30 * 24 * time.Hour
+	presenceTimeout = 2 * time.Second
+)
+
+// presenceTracker is set once StartPresence has connected to Redis
+var presenceTracker atomic.Pointer[PresenceTracker]
+
+// PresenceTracker keeps each user's presence in Redis, shared by all
+// instances. Every connection is a member of the user's active or away set,
+// scored by when it expires; heartbeats keep local connections alive.
+type PresenceTracker struct {
+	rdb *redis.Client
+
+	// OnChange is called when a user's status changes
+	OnChange func(models.Presence)
+
+	mu    sync.Mutex
+	conns map[*WSClient]*presenceConn
+}
+
+type presenceConn struct {
+	id   string
+	away bool
+}
+
+func NewPresenceTracker(rdb *redis.Client) *PresenceTracker {
+	return &PresenceTracker{rdb: rdb, conns: make(map[*WSClient]*presenceConn)}
+}
+
+func presenceKey(userID int, part string) string {
+	return "presence:" + strconv.Itoa(userID) + ":" + part
+}
+
+// Connect records a new connection as active
+func (p *PresenceTracker) Connect(ctx context.Context, c *WSClient) error {
+	pc := &presenceConn{id: uuid.NewString()}
+	p.mu.Lock()
+	p.conns[c] = pc
+	p.mu.Unlock()
+	return p.touch(ctx, c.UserID, pc)
+}
+
+// SetAway marks a connection away, or active again
+func (p *PresenceTracker) SetAway(ctx context.Context, c *WSClient, away bool) error {
+	p.mu.Lock()
+	pc, ok := p.conns[c]
+	if ok {
+		pc.away = away
+	}
+	p.mu.Unlock()
+	if !ok {
+		return ErrClientClosed
+	}
+	return p.touch(ctx, c.UserID, &presenceConn{id: pc.id, away: away})
+}
+
+// Disconnect removes a connection; the user's last-seen time is now
+func (p *PresenceTracker) Disconnect(ctx context.Context, c *WSClient) error {
+	p.mu.Lock()
+	pc, ok := p.conns[c]
+	delete(p.conns, c)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	pipe := p.rdb.TxPipeline()
+	pipe.ZRem(ctx, presenceKey(c.UserID, "active"), pc.id)
+	pipe.ZRem(ctx, presenceKey(c.UserID, "away"), pc.id)
+	pipe.Set(ctx, presenceKey(c.UserID, "last_seen"), time.Now().Unix(), lastSeenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return p.update(ctx, c.UserID)
+}
+
+// Heartbeat extends every local connection
+func (p *PresenceTracker) Heartbeat(ctx context.Context) error {
+	p.mu.Lock()
+	conns := make(map[*WSClient]presenceConn, len(p.conns))
+	for c, pc := range p.conns {
+		conns[c] = *pc
+	}
+	p.mu.Unlock()
+
+	pipe := p.rdb.Pipeline()
+	for c, pc := range conns {
+		p.queueTouch(ctx, pipe, c.UserID, pc)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// touch (re)adds a connection to the set for its state and updates the status
+func (p *PresenceTracker) touch(ctx context.Context, userID int, pc *presenceConn) error {
+	pipe := p.rdb.TxPipeline()
+	p.queueTouch(ctx, pipe, userID, *pc)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return p.update(ctx, userID)
+}
+
+func (p *PresenceTracker) queueTouch(ctx context.Context, pipe redis.Pipeliner, userID int, pc presenceConn) {
+	set, other := presenceKey(userID, "active"), presenceKey(userID, "away")
+	if pc.away {
+		set, other = other, set
+	}
+	expires := float64(time.Now().Add(presenceTTL).Unix())
+	pipe.ZRem(ctx, other, pc.id)
+	pipe.ZAdd(ctx, set, redis.Z{Score: expires, Member: pc.id})
+	pipe.Expire(ctx, set, presenceTTL)
+	pipe.Set(ctx, presenceKey(userID, "last_seen"), time.Now().Unix(), lastSeenTTL)
+}
+
+// update stores the user's current status and reports a change to OnChange.
+// The stored status is swapped atomically, so only one instance reports it.
+func (p *PresenceTracker) update(ctx context.Context, userID int) error {
+	current, err := p.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	previous, err := p.rdb.SetArgs(ctx, presenceKey(userID, "status"), current.Status,
+		redis.SetArgs{Get: true, TTL: lastSeenTTL}).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if previous == current.Status || (previous == "" && current.Status == models.PresenceOffline) {
+		return nil
+	}
+	if p.OnChange != nil {
+		p.OnChange(current)
+	}
+	return nil
+}
+
+// Get returns a user's presence, dropping connections whose heartbeats stopped
+func (p *PresenceTracker) Get(ctx context.Context, userID int) (models.Presence, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	active, away := presenceKey(userID, "active"), presenceKey(userID, "away")
+	pipe := p.rdb.Pipeline()
+	pipe.ZRemRangeByScore(ctx, active, "-inf", "("+now)
+	pipe.ZRemRangeByScore(ctx, away, "-inf", "("+now)
+	activeCount := pipe.ZCard(ctx, active)
+	awayCount := pipe.ZCard(ctx, away)
+	lastSeen := pipe.Get(ctx, presenceKey(userID, "last_seen"))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return models.Presence{}, err
+	}
+
+	presence := models.Presence{UserID: userID, Status: models.PresenceOffline}
+	switch {
+	case activeCount.Val() > 0:
+		presence.Status = models.PresenceOnline
+	case awayCount.Val() > 0:
+		presence.Status = models.PresenceAway
+	}
+	if ts, err := lastSeen.Int64(); err == nil {
+		t := time.Unix(ts, 0).UTC()
+		presence.LastSeen = &t
+	}
+	return presence, nil
+}
+
+// PresenceConnect, PresenceSetAway and PresenceDisconnect track the default
+// hub's connections; without Redis they do nothing.
+func PresenceConnect(c *WSClient) {
+	if p := presenceTracker.Load(); p != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+		defer cancel()
+		if err := p.Connect(ctx, c); err != nil {
+			log.Printf("Presence: failed to record connection of user %d: %v", c.UserID, err)
+		}
+	}
+}
+
+func PresenceSetAway(c *WSClient, away bool) error {
+	p := presenceTracker.Load()
+	if p == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+	return p.SetAway(ctx, c, away)
+}
+
+func PresenceDisconnect(c *WSClient) {
+	if p := presenceTracker.Load(); p != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+		defer cancel()
+		if err := p.Disconnect(ctx, c); err != nil {
+			log.Printf("Presence: failed to record disconnect of user %d: %v", c.UserID, err)
+		}
+	}
+}
+
+// GetPresence looks up several users. Without Redis only connections to this
+// instance are known and there is no last-seen time.
+func GetPresence(ctx context.Context, userIDs []int) ([]models.Presence, error) {
+	p := presenceTracker.Load()
+	out := make([]models.Presence, 0, len(userIDs))
+	for _, id := range userIDs {
+		if p == nil {
+			status := models.PresenceOffline
+			if hub.Connections(id) > 0 {
+				status = models.PresenceOnline
+			}
+			out = append(out, models.Presence{UserID: id, Status: status})
+			continue
+		}
+		presence, err := p.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, presence)
+	}
+	return out, nil
+}
+
+// pushPresence tells the members of the user's rooms about a status change
+func pushPresence(pr models.Presence) {
+	rooms, err := UserRooms(context.Background(), pr.UserID)
+	if err != nil {
+		log.Printf("Presence: failed to load rooms of user %d: %v", pr.UserID, err)
+		return
+	}
+	at := time.Now().UTC()
+	if pr.LastSeen != nil && pr.Status == models.PresenceOffline {
+		at = *pr.LastSeen
+	}
+	for _, room := range rooms {
+		PublishRoom(room, models.ChatFrame{Type: models.ChatPresence, Room: room, From: pr.UserID, Status: pr.Status, SentAt: at})
+	}
+}
+
+// StartPresence tracks presence in Redis and sends heartbeats until ctx is
+// done. Without Redis presence reflects this instance's connections only.
+func StartPresence(ctx context.Context) {
+	rdb := InitRedis()
+	if rdb == nil {
+		log.Println("Redis not available; presence covers this instance only")
+		return
+	}
+	p := NewPresenceTracker(rdb)
+	p.OnChange = pushPresence
+	presenceTracker.Store(p)
+	defer presenceTracker.Store(nil)
+
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Heartbeat(ctx); err != nil {
+			log.Printf("Presence heartbeat failed: %v", err)
+		}
+	}
+}
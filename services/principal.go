@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	Err2FARequired  = errors.New("2FA required")
+)
+
+// Principal is the authenticated caller of an HTTP or gRPC request
+type Principal struct {
+	UserID int    // 0 for API keys and certificates
+	Name   string // API key or certificate name; empty for users
+	Role   string
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal attaches the caller to ctx
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller attached by the auth interceptor
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ParseAccessToken validates a full (2FA-verified) JWT
+func ParseAccessToken(tokenString string) (*Principal, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	id, _ := claims["id"].(float64)
+	role, _ := claims["role"].(string)
+	if verified, _ := claims["2fa"].(bool); !verified {
+		return nil, Err2FARequired
+	}
+	return &Principal{UserID: int(id), Role: role}, nil
+}
+
+// LookupAPIKey checks a key against API_KEYS, a comma-separated list of
+// name:key:role entries (role defaults to "service").
+func LookupAPIKey(key string) (*Principal, bool) {
+	if key == "" {
+		return nil, false
+	}
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) < 2 || parts[1] == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(key)) == 1 {
+			role := "service"
+			if len(parts) == 3 && parts[2] != "" {
+				role = parts[2]
+			}
+			return &Principal{Name: parts[0], Role: role}, true
+		}
+	}
+	return nil, false
+}
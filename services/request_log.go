@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// RequestLogTopic carries request logs from every replica to the writer
+const RequestLogTopic = "request-logs"
+
+const (
+	requestLogBuffer        = 10000
+	requestLogBatchSize     = 500
+	requestLogFlushInterval = time.Second
+	requestLogInsertBatch   = 1000
+	requestLogInsertEvery   = 2 * time.Second
+)
+
+var requestLogColumns = []string{"time", "method", "path", "status", "duration_ms", "user_id", "ip", "user_agent"}
+
+var (
+	requestLogsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_logs_dropped_total",
+			Help: "Request logs dropped before reaching Kafka, by reason",
+		},
+		[]string{"reason"},
+	)
+	requestLogsStored = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "request_logs_stored_total",
+			Help: "Request logs inserted into Postgres",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestLogsDropped, requestLogsStored)
+}
+
+// RequestLogPublisher buffers request logs and hands them to Write in
+// batches, so logging a request never waits for Kafka. Entries arriving
+// while the buffer is full are dropped.
+type RequestLogPublisher struct {
+	Write         func(ctx context.Context, batch []models.RequestLog) error
+	BatchSize     int
+	FlushInterval time.Duration
+
+	entries chan models.RequestLog
+}
+
+func NewRequestLogPublisher(buffer int, write func(ctx context.Context, batch []models.RequestLog) error) *RequestLogPublisher {
+	return &RequestLogPublisher{
+		Write:         write,
+		BatchSize:     requestLogBatchSize,
+		FlushInterval: requestLogFlushInterval,
+		entries:       make(chan models.RequestLog, buffer),
+	}
+}
+
+// Publish queues an entry; it reports false if the buffer was full
+func (p *RequestLogPublisher) Publish(entry models.RequestLog) bool {
+	select {
+	case p.entries <- entry:
+		return true
+	default:
+		requestLogsDropped.WithLabelValues("buffer_full").Inc()
+		return false
+	}
+}
+
+// Run writes queued entries whenever BatchSize have arrived or
+// FlushInterval has passed. Once ctx is done it writes what is left and
+// returns.
+func (p *RequestLogPublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]models.RequestLog, 0, p.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.Write(ctx, batch); err != nil {
+			log.Printf("Failed to publish %d request logs: %v", len(batch), err)
+			requestLogsDropped.WithLabelValues("write_error").Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry := <-p.entries:
+			batch = append(batch, entry)
+			if len(batch) >= p.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case entry := <-p.entries:
+					batch = append(batch, entry)
+				default:
+					break drain
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flush(shutdownCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// requestLogPublisher is set while StartRequestLogPublisher runs
+var requestLogPublisher atomic.Pointer[RequestLogPublisher]
+
+// SetRequestLogPublisher makes LogRequest queue entries on p; nil stops
+// logging requests
+func SetRequestLogPublisher(p *RequestLogPublisher) {
+	requestLogPublisher.Store(p)
+}
+
+// LogRequest queues a request log for storage; it never blocks
+func LogRequest(entry models.RequestLog) {
+	if p := requestLogPublisher.Load(); p != nil {
+		p.Publish(entry)
+	}
+}
+
+// StartRequestLogPublisher sends logged requests to Kafka until ctx is done
+func StartRequestLogPublisher(ctx context.Context) {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(kafkaBroker()),
+		Topic:        RequestLogTopic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchSize:    requestLogBatchSize,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	defer writer.Close()
+
+	p := NewRequestLogPublisher(requestLogBuffer, func(ctx context.Context, batch []models.RequestLog) error {
+		msgs := make([]kafka.Message, len(batch))
+		for i, entry := range batch {
+			value, _ := json.Marshal(entry)
+			msgs[i] = kafka.Message{Value: value}
+		}
+		return writer.WriteMessages(ctx, msgs...)
+	})
+	SetRequestLogPublisher(p)
+	defer SetRequestLogPublisher(nil)
+	log.Println("Starting request log publisher")
+	p.Run(ctx)
+}
+
+// StartRequestLogConsumer stores request logs from Kafka in Postgres in
+// batches, committing the offsets once a batch is inserted. A batch that
+// cannot be inserted is retried and reading pauses until it goes in; a crash
+// between insert and commit stores that batch twice.
+func StartRequestLogConsumer(ctx context.Context) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{kafkaBroker()},
+		Topic:    RequestLogTopic,
+		GroupID:  "request-log-writer",
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	defer r.Close()
+	defer trackKafkaConsumer("request-logs", r)()
+
+	fetched := make(chan kafka.Message)
+	go func() {
+		defer close(fetched)
+		for {
+			msg, err := r.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Failed to read request logs from Kafka: %v", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(5 * time.Second):
+				}
+				continue
+			}
+			select {
+			case fetched <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Println("Starting request log consumer")
+	var pending []kafka.Message
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		entries := make([]models.RequestLog, 0, len(pending))
+		for _, msg := range pending {
+			var entry models.RequestLog
+			if err := json.Unmarshal(msg.Value, &entry); err != nil {
+				log.Printf("Skipping undecodable request log at offset %d: %v", msg.Offset, err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		n, err := InsertRequestLogs(ctx, entries)
+		if err != nil {
+			log.Printf("Failed to store %d request logs: %v", len(entries), err)
+			return
+		}
+		requestLogsStored.Add(float64(n))
+		if err := r.CommitMessages(ctx, pending...); err != nil {
+			log.Printf("Failed to commit request log offsets: %v", err)
+		}
+		pending = pending[:0]
+	}
+
+	ticker := time.NewTicker(requestLogInsertEvery)
+	defer ticker.Stop()
+	for {
+		in := fetched
+		if len(pending) >= requestLogInsertBatch {
+			in = nil
+		}
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				return
+			}
+			pending = append(pending, msg)
+			if len(pending) >= requestLogInsertBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// InsertRequestLogs bulk-inserts entries with COPY
+func InsertRequestLogs(ctx context.Context, entries []models.RequestLog) (int64, error) {
+	if DB() == nil {
+		return 0, errors.New("database not available")
+	}
+	return DB().CopyFrom(ctx, pgx.Identifier{"request_logs"}, requestLogColumns,
+		pgx.CopyFromSlice(len(entries), func(i int) ([]interface{}, error) {
+			e := entries[i]
+			var userID interface{}
+			if e.UserID != 0 {
+				userID = e.UserID
+			}
+			return []interface{}{e.Time, e.Method, e.Path, e.Status, e.DurationMs, userID, e.IP, e.UserAgent}, nil
+		}))
+}
+
+// RequestLogFilter selects request logs; zero fields match everything
+type RequestLogFilter struct {
+	UserID     int
+	PathPrefix string
+	StatusMin  int
+	StatusMax  int
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	Before     int64      // cursor: only logs with a lower ID
+	Limit      int
+}
+
+// QueryRequestLogs returns the logs matching f, newest first
+func QueryRequestLogs(ctx context.Context, f RequestLogFilter) ([]models.RequestLog, error) {
+	if DB() == nil {
+		return nil, errors.New("database not available")
+	}
+	rows, err := DB().Query(ctx, `
+		SELECT id, time, method, path, status, duration_ms, COALESCE(user_id, 0), ip, user_agent
+		FROM request_logs
+		WHERE ($1 = 0 OR user_id = $1)
+			AND ($2 = '' OR starts_with(path, $2))
+			AND ($3 = 0 OR status >= $3)
+			AND ($4 = 0 OR status <= $4)
+			AND ($5::timestamptz IS NULL OR time >= $5)
+			AND ($6::timestamptz IS NULL OR time < $6)
+			AND ($7 = 0 OR id < $7)
+		ORDER BY id DESC LIMIT $8`,
+		f.UserID, f.PathPrefix, f.StatusMin, f.StatusMax, f.From, f.To, f.Before, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	logs := []models.RequestLog{}
+	for rows.Next() {
+		var e models.RequestLog
+		if err := rows.Scan(&e.ID, &e.Time, &e.Method, &e.Path, &e.Status, &e.DurationMs, &e.UserID, &e.IP, &e.UserAgent); err != nil {
+			return nil, err
+		}
+		logs = append(logs, e)
+	}
+	return logs, rows.Err()
+}
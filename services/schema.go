@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+)
+
+// schema holds the tables created alongside users at startup
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id BIGSERIAL PRIMARY KEY,
+		topic TEXT NOT NULL,
+		key TEXT,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		sent_at TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL`,
+	`ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ`,
+	`CREATE TABLE IF NOT EXISTS notifications (
+		id BIGSERIAL PRIMARY KEY,
+		email TEXT NOT NULL,
+		subject TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		idempotency_key TEXT,
+		status TEXT NOT NULL DEFAULT 'scheduled',
+		send_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		error TEXT,
+		created_by INT,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS notifications_due_idx ON notifications (send_at) WHERE status = 'scheduled'`,
+	// Idempotency keys are unique per creator, not globally
+	`ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_idempotency_key_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS notifications_idempotency_idx ON notifications ((COALESCE(created_by, 0)), idempotency_key)`,
+	// API keys and certificates have no user, so their keys are scoped by name
+	`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS created_by_name TEXT NOT NULL DEFAULT ''`,
+	`DROP INDEX IF EXISTS notifications_idempotency_idx`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS notifications_owner_idempotency_idx ON notifications ((COALESCE(created_by, 0)), created_by_name, idempotency_key)`,
+	`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS user_id INT`,
+	`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT 'general'`,
+	`CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id INT NOT NULL,
+		category TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		PRIMARY KEY (user_id, category, channel)
+	)`,
+	`CREATE TABLE IF NOT EXISTS notification_settings (
+		user_id INT PRIMARY KEY,
+		quiet_start TEXT,
+		quiet_end TEXT,
+		timezone TEXT NOT NULL DEFAULT 'UTC'
+	)`,
+	`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'`,
+	`CREATE INDEX IF NOT EXISTS notifications_digest_idx ON notifications (user_id) WHERE status = 'digest'`,
+	`ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS digest_frequency TEXT NOT NULL DEFAULT 'off'`,
+	`ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMPTZ`,
+	`CREATE TABLE IF NOT EXISTS chat_rooms (
+		name TEXT PRIMARY KEY,
+		private BOOLEAN NOT NULL DEFAULT false,
+		created_by INT,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_room_members (
+		room TEXT NOT NULL REFERENCES chat_rooms (name) ON DELETE CASCADE,
+		user_id INT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'member',
+		joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (room, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_room_members_user_idx ON chat_room_members (user_id)`,
+	`INSERT INTO chat_rooms (name) VALUES ('global') ON CONFLICT DO NOTHING`,
+	`CREATE TABLE IF NOT EXISTS chat_messages (
+		id BIGSERIAL PRIMARY KEY,
+		room TEXT REFERENCES chat_rooms (name) ON DELETE CASCADE,
+		sender_id INT NOT NULL,
+		recipient_id INT,
+		message TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_messages_room_idx ON chat_messages (room, id) WHERE room IS NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS chat_messages_recipient_idx ON chat_messages (recipient_id, id) WHERE recipient_id IS NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS chat_messages_sender_idx ON chat_messages (sender_id, id) WHERE recipient_id IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS inbox_items (
+		id BIGSERIAL PRIMARY KEY,
+		user_id INT NOT NULL,
+		notification_id BIGINT,
+		category TEXT NOT NULL DEFAULT 'general',
+		priority TEXT NOT NULL DEFAULT 'normal',
+		subject TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		read_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS inbox_items_user_idx ON inbox_items (user_id, id)`,
+	`CREATE INDEX IF NOT EXISTS inbox_items_unread_idx ON inbox_items (user_id) WHERE read_at IS NULL`,
+	`CREATE INDEX IF NOT EXISTS inbox_items_expires_idx ON inbox_items (expires_at)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS inbox_items_notification_idx ON inbox_items (user_id, notification_id) WHERE notification_id IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS chat_room_sanctions (
+		room TEXT NOT NULL REFERENCES chat_rooms (name) ON DELETE CASCADE,
+		user_id INT NOT NULL,
+		kind TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_by INT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ,
+		PRIMARY KEY (room, user_id, kind)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_reports (
+		id BIGSERIAL PRIMARY KEY,
+		message_id BIGINT NOT NULL,
+		room TEXT,
+		sender_id INT NOT NULL,
+		message TEXT NOT NULL,
+		reporter_id INT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		reviewed_by INT,
+		reviewed_at TIMESTAMPTZ,
+		UNIQUE (message_id, reporter_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_reports_status_idx ON chat_reports (status, id)`,
+	`CREATE TABLE IF NOT EXISTS request_logs (
+		id BIGSERIAL PRIMARY KEY,
+		time TIMESTAMPTZ NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INT NOT NULL,
+		duration_ms DOUBLE PRECISION NOT NULL,
+		user_id INT,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS request_logs_time_idx ON request_logs (time)`,
+	`CREATE INDEX IF NOT EXISTS request_logs_user_idx ON request_logs (user_id, time) WHERE user_id IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS cron_runs (
+		id BIGSERIAL PRIMARY KEY,
+		job TEXT NOT NULL,
+		scheduled_at TIMESTAMPTZ NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		instance TEXT NOT NULL,
+		UNIQUE (job, scheduled_at)
+	)`,
+	`CREATE INDEX IF NOT EXISTS cron_runs_job_idx ON cron_runs (job, id)`,
+}
+
+func migrate(d DBInterface) error {
+	for _, stmt := range schema {
+		if _, err := d.Exec(context.Background(), stmt); err != nil {
+			return fmt.Errorf("schema statement failed: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+	"user-notification-api/models"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// InboxReplayLimit caps the notifications replayed to a resuming event
+// stream; older ones can be paged in from /me/inbox.
+const InboxReplayLimit = 500
+
+// SSEConn writes hub messages as Server-Sent Events, so event stream clients
+// share the hub with WebSocket ones. Each message is one event whose data is
+// the same JSON a WebSocket client receives; notifications kept in the inbox
+// carry the inbox item ID as the event ID. Pings become comments.
+type SSEConn struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closed bool
+	done   chan struct{}
+}
+
+var (
+	sseStreamsMu sync.Mutex
+	sseStreams   = make(map[*SSEConn]struct{})
+	sseClosing   bool
+)
+
+// NewSSEConn returns an open stream, or one that is already closed once
+// CloseSSEStreams has been called
+func NewSSEConn(w *bufio.Writer) *SSEConn {
+	s := &SSEConn{w: w, done: make(chan struct{})}
+	sseStreamsMu.Lock()
+	defer sseStreamsMu.Unlock()
+	if sseClosing {
+		s.closed = true
+		close(s.done)
+		return s
+	}
+	sseStreams[s] = struct{}{}
+	return s
+}
+
+// CloseSSEStreams ends every open event stream and refuses new ones. Clients
+// never end a stream themselves, so the HTTP server cannot shut down until
+// they are closed; browsers reconnect to another replica.
+func CloseSSEStreams() {
+	sseStreamsMu.Lock()
+	sseClosing = true
+	streams := make([]*SSEConn, 0, len(sseStreams))
+	for s := range sseStreams {
+		streams = append(streams, s)
+	}
+	sseStreamsMu.Unlock()
+	for _, s := range streams {
+		s.Close()
+	}
+}
+
+// Done is closed once the stream has ended
+func (s *SSEConn) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *SSEConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClientClosed
+	}
+	if id := notificationEventID(v); id != 0 {
+		s.w.WriteString("id: " + strconv.FormatInt(id, 10) + "\n")
+	}
+	s.w.WriteString("data: ")
+	s.w.Write(data)
+	s.w.WriteString("\n\n")
+	return s.w.Flush()
+}
+
+// WriteMessage only handles pings, the one kind of message the hub writes this way
+func (s *SSEConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.PingMessage {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClientClosed
+	}
+	s.w.WriteString(": ping\n\n")
+	return s.w.Flush()
+}
+
+// WriteControl is only used to close the connection
+func (s *SSEConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return s.Close()
+}
+
+// The stream is write-only, so there are no read deadlines or pongs; a dead
+// client shows up as a failed write.
+func (s *SSEConn) SetWriteDeadline(t time.Time) error          { return nil }
+func (s *SSEConn) SetReadDeadline(t time.Time) error           { return nil }
+func (s *SSEConn) SetPongHandler(h func(appData string) error) {}
+
+// Close ends the stream; nothing is written after it returns
+func (s *SSEConn) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	sseStreamsMu.Lock()
+	delete(sseStreams, s)
+	sseStreamsMu.Unlock()
+	return nil
+}
+
+// notificationEventID returns the inbox item ID of a notification event, as
+// queued locally or relayed by the backplane, and 0 for anything else.
+func notificationEventID(v interface{}) int64 {
+	switch m := v.(type) {
+	case Event:
+		if item, ok := m.Data.(*models.InboxItem); ok && m.Type == EventNotification {
+			return item.ID
+		}
+	case json.RawMessage:
+		var e struct {
+			Type string `json:"type"`
+			Data struct {
+				ID int64 `json:"id"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(m, &e) == nil && e.Type == EventNotification {
+			return e.Data.ID
+		}
+	}
+	return 0
+}
+
+// InboxReplayLoader returns missed inbox items, oldest first
+type InboxReplayLoader func() ([]models.InboxItem, error)
+
+// RegisterInboxReplay is Register for a client resuming after a notification:
+// the items returned by load are sent as notification events before anything
+// sent to the connection afterwards.
+func (h *Hub) RegisterInboxReplay(userID int, conn WSConn, load InboxReplayLoader) *WSClient {
+	return h.register(userID, conn, &replay{
+		load: func() ([]interface{}, error) {
+			items, err := load()
+			out := make([]interface{}, len(items))
+			for i := range items {
+				out[i] = Event{Type: EventNotification, Data: &items[i]}
+			}
+			return out, err
+		},
+		id: notificationEventID,
+		failed: func() interface{} {
+			return Event{Type: EventError, Data: map[string]string{"error": "failed to load missed notifications"}}
+		},
+		ready: make(chan struct{}),
+	})
+}
+
+// RegisterSSE adds an event stream to the default hub. A stream resuming from
+// lastEventID first receives the notifications it missed.
+func RegisterSSE(userID int, conn *SSEConn, lastEventID int64) *WSClient {
+	if lastEventID <= 0 {
+		return hub.Register(userID, conn)
+	}
+	return hub.RegisterInboxReplay(userID, conn, func() ([]models.InboxItem, error) {
+		return InboxSince(context.Background(), userID, lastEventID, InboxReplayLimit)
+	})
+}
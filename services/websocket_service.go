@@ -1,44 +1,386 @@
 package services
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/gofiber/websocket/v2"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// WebSocket event types
+const (
+	EventNotification = "notification"
+	EventWelcomeBack  = "welcome_back"
+	EventError        = "error"
+)
+
+// Event is a server-initiated WebSocket message
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
 var (
-	clients   = make(map[*websocket.Conn]string)
-	clientsMu sync.Mutex
-	broadcast = make(chan string)
+	ErrClientClosed = errors.New("websocket client closed")
+	ErrQueueFull    = errors.New("websocket send queue full")
+)
+
+// Hub defaults; a ping every PingInterval keeps the read deadline, PongWait,
+// from expiring on healthy connections.
+const (
+	DefaultQueueSize    = 256
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultPongWait     = 60 * time.Second
+	DefaultPingInterval = DefaultPongWait * 9 / 10
+	DefaultMaxDrops     = 32
 )
 
-func HandleWebSocket(c *websocket.Conn) {
-	defer c.Close()
-	userID := c.Locals("userID").(int)
-	clientsMu.Lock()
-	clients[c] = fmt.Sprintf("%d", userID)
-	clientsMu.Unlock()
+// WSConn is the part of a WebSocket connection the hub uses. Only the
+// client's writer goroutine writes data frames; WriteControl and Close may be
+// called concurrently.
+type WSConn interface {
+	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// WSClient is one registered connection. Send only queues the message; a
+// writer goroutine per connection drains the queue, so a slow client never
+// blocks the sender or other clients.
+type WSClient struct {
+	UserID int
+	conn   WSConn
+	hub    *Hub
+	queue  chan interface{}
+	done   chan struct{}
+	rooms  map[string]struct{} // guarded by hub.mu
+
+	// replayedUpTo is the highest message ID replayed to the client, as
+	// returned by replayedID; the writer skips live copies of those messages.
+	// Only the writer uses them.
+	replayedUpTo int64
+	replayedID   func(v interface{}) int64
+
+	mu     sync.Mutex // guards closed and drops
+	closed bool
+	drops  int // consecutive messages dropped because the queue was full
+}
+
+// Send queues v for the connection. When the queue is full the message is
+// dropped, and after MaxDrops drops in a row the client is disconnected as
+// a slow consumer.
+func (c *WSClient) Send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	select {
+	case c.queue <- v:
+		wsQueueDepth.Inc()
+		c.drops = 0
+		return nil
+	default:
+	}
+
+	wsDropped.WithLabelValues("queue_full").Inc()
+	c.drops++
+	if c.drops >= c.hub.MaxDrops {
+		log.Printf("Disconnecting slow WebSocket consumer for user %d after %d dropped messages", c.UserID, c.drops)
+		wsSlowDisconnects.Inc()
+		c.closed = true
+		close(c.done)
+		// Closing the connection ends the handler's read loop, which unregisters the client
+		go func() {
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow"),
+				time.Now().Add(time.Second))
+			c.conn.Close()
+		}()
+	}
+	return ErrQueueFull
+}
+
+// stop ends the writer goroutine; queued messages are discarded
+func (c *WSClient) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+}
 
-	c.WriteMessage(websocket.TextMessage, []byte("Welcome back!"))
+// writeLoop writes queued messages and periodic pings, each with a write
+// deadline. A failed write closes the connection, which ends the handler's
+// read loop and unregisters the client.
+func (c *WSClient) writeLoop() {
+	ticker := time.NewTicker(c.hub.PingInterval)
+	defer ticker.Stop()
 	for {
-		_, msg, err := c.ReadMessage()
-		if err != nil {
-			clientsMu.Lock()
-			delete(clients, c)
-			clientsMu.Unlock()
-			break
+		select {
+		case <-c.done:
+			c.drain()
+			return
+		case v := <-c.queue:
+			wsQueueDepth.Dec()
+			if r, ok := v.(*replay); ok {
+				if !c.replay(r) {
+					c.fail()
+					return
+				}
+				continue
+			}
+			if c.replayed(v) {
+				continue
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.WriteTimeout))
+			if err := c.conn.WriteJSON(v); err != nil {
+				log.Printf("Failed to send WebSocket message to user %d: %v", c.UserID, err)
+				wsDropped.WithLabelValues("write_error").Inc()
+				c.fail()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.fail()
+				return
+			}
+		}
+	}
+}
+
+func (c *WSClient) fail() {
+	c.conn.Close()
+	c.hub.Unregister(c)
+	c.drain()
+}
+
+// drain discards messages left in the queue once Send has stopped accepting
+func (c *WSClient) drain() {
+	for {
+		select {
+		case <-c.queue:
+			wsQueueDepth.Dec()
+		default:
+			return
+		}
+	}
+}
+
+// Hub tracks WebSocket connections by user ID, and the chat rooms each
+// connection has joined; a user may be connected from several devices at
+// once. Change the settings before registering clients.
+type Hub struct {
+	QueueSize    int           // messages buffered per connection
+	WriteTimeout time.Duration // deadline for each write
+	PongWait     time.Duration // read deadline, extended by every pong
+	PingInterval time.Duration // must be shorter than PongWait
+	MaxDrops     int           // consecutive drops before disconnecting
+
+	mu    sync.RWMutex
+	users map[int]map[*WSClient]struct{}
+	rooms map[string]map[*WSClient]struct{}
+}
+
+var (
+	hub = NewHub()
+
+	wsConnections = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_connections_active",
+			Help: "Number of active WebSocket connections",
+		},
+	)
+	wsQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_send_queue_depth",
+			Help: "Messages waiting in WebSocket send queues across all connections",
+		},
+	)
+	wsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_messages_dropped_total",
+			Help: "WebSocket messages dropped by reason",
+		},
+		[]string{"reason"},
+	)
+	wsSlowDisconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_slow_consumer_disconnects_total",
+			Help: "WebSocket connections closed because their send queue stayed full",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(wsConnections, wsQueueDepth, wsDropped, wsSlowDisconnects)
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		QueueSize:    DefaultQueueSize,
+		WriteTimeout: DefaultWriteTimeout,
+		PongWait:     DefaultPongWait,
+		PingInterval: DefaultPingInterval,
+		MaxDrops:     DefaultMaxDrops,
+		users:        make(map[int]map[*WSClient]struct{}),
+		rooms:        make(map[string]map[*WSClient]struct{}),
+	}
+}
+
+// WSHub returns the hub used by the /ws endpoint
+func WSHub() *Hub {
+	return hub
+}
+
+// Notify sends event to every connection of userID, on all instances once
+// the backplane is running, and returns how many local connections
+// received it.
+func Notify(userID int, event interface{}) int {
+	if b := backplane.Load(); b != nil {
+		return b.Notify(userID, event)
+	}
+	return hub.Notify(userID, event)
+}
+
+// Broadcast sends v to every connected client on all instances
+func Broadcast(v interface{}) int {
+	if b := backplane.Load(); b != nil {
+		return b.Broadcast(v)
+	}
+	return hub.Broadcast(v)
+}
+
+// PublishRoom sends v to every connection subscribed to room, on all
+// instances
+func PublishRoom(room string, v interface{}) int {
+	if b := backplane.Load(); b != nil {
+		return b.PublishRoom(room, v)
+	}
+	return hub.PublishRoom(room, v)
+}
+
+// RemoveFromRoom unsubscribes userID's connections from room on all instances
+func RemoveFromRoom(room string, userID int) {
+	if b := backplane.Load(); b != nil {
+		b.RemoveFromRoom(room, userID)
+		return
+	}
+	hub.RemoveFromRoom(room, userID)
+}
+
+// Register adds a connection for userID, sets up ping/pong keepalive and
+// starts its writer goroutine. The caller keeps reading from the connection
+// and calls Unregister when reading fails.
+func (h *Hub) Register(userID int, conn WSConn) *WSClient {
+	return h.register(userID, conn, nil)
+}
+
+// RegisterReplay is Register for a reconnecting client: the messages returned
+// by load are written before anything sent to the connection afterwards.
+func (h *Hub) RegisterReplay(userID int, conn WSConn, load ReplayLoader) *WSClient {
+	return h.register(userID, conn, newReplay(load))
+}
+
+func (h *Hub) register(userID int, conn WSConn, r *replay) *WSClient {
+	c := &WSClient{
+		UserID: userID,
+		conn:   conn,
+		hub:    h,
+		queue:  make(chan interface{}, h.QueueSize),
+		done:   make(chan struct{}),
+		rooms:  make(map[string]struct{}),
+	}
+	conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	})
+
+	h.mu.Lock()
+	if h.users[userID] == nil {
+		h.users[userID] = make(map[*WSClient]struct{})
+	}
+	if r != nil {
+		// Queued ahead of live messages; loaded only once the client is reachable
+		c.queue <- r
+		wsQueueDepth.Inc()
+		defer close(r.ready)
+	}
+	h.users[userID][c] = struct{}{}
+	h.mu.Unlock()
+	wsConnections.Inc()
+
+	go c.writeLoop()
+	return c
+}
+
+// Unregister removes a connection and stops its writer; removing it twice
+// is a no-op
+func (h *Hub) Unregister(c *WSClient) {
+	c.stop()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conns := h.users[c.UserID]
+	if _, ok := conns[c]; !ok {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(h.users, c.UserID)
+	}
+	for room := range c.rooms {
+		h.leave(c, room)
+	}
+	wsConnections.Dec()
+}
+
+// Connections returns the number of open connections for userID
+func (h *Hub) Connections(userID int) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.users[userID])
+}
+
+// Notify queues v for every connection of userID
+func (h *Hub) Notify(userID int, v interface{}) int {
+	h.mu.RLock()
+	targets := make([]*WSClient, 0, len(h.users[userID]))
+	for c := range h.users[userID] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	return h.send(targets, v)
+}
+
+// Broadcast queues v for every connection
+func (h *Hub) Broadcast(v interface{}) int {
+	h.mu.RLock()
+	var targets []*WSClient
+	for _, conns := range h.users {
+		for c := range conns {
+			targets = append(targets, c)
 		}
-		broadcast <- string(msg)
 	}
+	h.mu.RUnlock()
+	return h.send(targets, v)
 }
 
-func BroadcastMessage() {
-	for msg := range broadcast {
-		clientsMu.Lock()
-		for client := range clients {
-			client.WriteMessage(websocket.TextMessage, []byte(msg))
+// send returns the number of connections v was queued for
+func (h *Hub) send(targets []*WSClient, v interface{}) int {
+	queued := 0
+	for _, c := range targets {
+		if c.Send(v) == nil {
+			queued++
 		}
-		clientsMu.Unlock()
 	}
+	return queued
 }
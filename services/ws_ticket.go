@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WSTicketTTL is how long a WebSocket ticket can be redeemed
+const WSTicketTTL = 30 * time.Second
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+type wsTicket struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func wsTicketKey(ticket string) string {
+	return "ws:ticket:" + ticket
+}
+
+// IssueWSTicket returns a random ticket that authenticates one WebSocket
+// upgrade as p within WSTicketTTL. Tickets live in Redis so any instance can
+// redeem them.
+func IssueWSTicket(ctx context.Context, rdb *redis.Client, p *Principal) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+	data, _ := json.Marshal(wsTicket{UserID: p.UserID, Role: p.Role})
+	if err := rdb.Set(ctx, wsTicketKey(ticket), data, WSTicketTTL).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// ConsumeWSTicket redeems a ticket. GETDEL makes it single-use even when two
+// instances receive it at the same time.
+func ConsumeWSTicket(ctx context.Context, rdb *redis.Client, ticket string) (*Principal, error) {
+	data, err := rdb.GetDel(ctx, wsTicketKey(ticket)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t wsTicket
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, ErrInvalidTicket
+	}
+	return &Principal{UserID: t.UserID, Role: t.Role}, nil
+}
@@ -0,0 +1,142 @@
+package cronTests
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2025, time.January, 31, 10, 17, 30, 0, time.UTC) // a Friday
+	cases := map[string]time.Time{
+		"* * * * *":      time.Date(2025, time.January, 31, 10, 18, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2025, time.January, 31, 10, 30, 0, 0, time.UTC),
+		"0 9-17/4 * * *": time.Date(2025, time.January, 31, 13, 0, 0, 0, time.UTC),
+		"30 3 * * *":     time.Date(2025, time.February, 1, 3, 30, 0, 0, time.UTC),
+		"0 0 * * 1,3":    time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":      time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":     time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * 5":      time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), // day of month or weekday
+		"@monthly":       time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for spec, want := range cases {
+		s, err := services.ParseCron(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, want, s.Next(from), spec)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * 0 *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *", "@often"} {
+		_, err := services.ParseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronLeaderElection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	a := services.NewCron(rdb, "cron:leader", "a", newMemoryRuns())
+	b := services.NewCron(rdb, "cron:leader", "b", newMemoryRuns())
+
+	leader, err := a.Campaign(ctx)
+	assert.NoError(t, err)
+	assert.True(t, leader)
+	leader, _ = b.Campaign(ctx)
+	assert.False(t, leader, "Expected one leader at a time")
+	leader, _ = a.Campaign(ctx)
+	assert.True(t, leader, "Expected the leader to renew its lease")
+
+	mr.FastForward(20 * time.Second)
+	leader, _ = b.Campaign(ctx)
+	assert.True(t, leader, "Expected another instance to take over an expired lease")
+	assert.NoError(t, b.Resign(ctx))
+	assert.False(t, b.IsLeader())
+	leader, _ = a.Campaign(ctx)
+	assert.True(t, leader, "Expected the lease free after resigning")
+}
+
+// memoryRuns is a CronRunStore shared by the instances of a test
+type memoryRuns struct {
+	mu   sync.Mutex
+	runs map[string]*models.CronRun
+}
+
+func newMemoryRuns() *memoryRuns {
+	return &memoryRuns{runs: make(map[string]*models.CronRun)}
+}
+
+func (m *memoryRuns) Start(ctx context.Context, run *models.CronRun) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := run.Job + run.ScheduledAt.String()
+	if _, ok := m.runs[key]; ok {
+		return false, nil
+	}
+	copied := *run
+	m.runs[key] = &copied
+	return true, nil
+}
+
+func (m *memoryRuns) Finish(ctx context.Context, run *models.CronRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *run
+	m.runs[run.Job+run.ScheduledAt.String()] = &copied
+	return nil
+}
+
+func (m *memoryRuns) statuses() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var statuses []string
+	for _, r := range m.runs {
+		statuses = append(statuses, r.Status)
+	}
+	return statuses
+}
+
+func TestCronRunsEachTickOnce(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	runs := newMemoryRuns()
+	var calls atomic.Int32
+	job := func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}
+
+	// Two instances that both believe they lead, as during a handover
+	a := services.NewCron(nil, "", "a", runs)
+	b := services.NewCron(nil, "", "b", runs)
+	follower := services.NewCron(rdb, "cron:leader", "c", runs)
+	mr.Set("cron:leader", "someone-else")
+	follower.Campaign(ctx)
+	for _, c := range []*services.Cron{a, b, follower} {
+		assert.NoError(t, c.Register("purge", "* * * * *", job))
+		assert.ErrorIs(t, c.Register("purge", "@daily", job), services.ErrCronJobExists)
+	}
+
+	due := time.Now().Add(time.Minute)
+	for _, c := range []*services.Cron{a, b, follower} {
+		c.Tick(ctx, due)
+	}
+	assert.Eventually(t, func() bool {
+		s := runs.statuses()
+		return len(s) == 1 && s[0] == models.CronSucceeded
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load(), "Expected the tick run once across instances")
+	assert.True(t, a.Jobs()[0].NextRun.After(due), "Expected the next run scheduled after the tick")
+}
@@ -0,0 +1,62 @@
+package grpcTests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"user-notification-api/handlers"
+
+	pb "user-notification-api/proto"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func startGateway(t *testing.T) *fiber.App {
+	conn := dialBufconn(t, func(srv *grpc.Server) {
+		pb.RegisterNotificationServiceServer(srv, &stubServer{})
+	})
+	gateway, err := handlers.NewGateway(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	app := fiber.New()
+	handlers.SetupGatewayRoutes(app, gateway)
+	return app
+}
+
+func TestGatewayForwardsAPIKey(t *testing.T) {
+	t.Setenv("API_KEYS", "billing:s3cret")
+	app := startGateway(t)
+
+	req := httptest.NewRequest("GET", "/v1/notifications/42", nil)
+	req.Header.Set("X-API-Key", "s3cret")
+	req.Header.Set("X-Request-Id", "req-1")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "req-1", resp.Header.Get("X-Request-Id"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "42", body["id"], "Expected int64 id as a JSON string")
+	assert.Equal(t, "service", body["status"])
+	assert.Equal(t, "billing", body["email"])
+}
+
+func TestGatewayErrors(t *testing.T) {
+	app := startGateway(t)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/notifications/42", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+	raw, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"error":"missing credentials"}`, string(raw))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/v1/notifications/abc", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "Expected invalid path parameter rejected")
+}
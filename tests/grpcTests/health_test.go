@@ -0,0 +1,61 @@
+package grpcTests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startHealthServer(t *testing.T, hs *health.Server) healthpb.HealthClient {
+	conn := dialBufconn(t, func(srv *grpc.Server) {
+		healthpb.RegisterHealthServer(srv, hs)
+	})
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestHealthCheckNeedsNoCredentials(t *testing.T) {
+	hs := health.NewServer()
+	client := startHealthServer(t, hs)
+
+	services.UpdateHealth(hs, map[string]error{
+		services.HealthPostgres: nil,
+		services.HealthRedis:    nil,
+		services.HealthKafka:    errors.New("connection refused"),
+	})
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status, "Expected Kafka outage not to fail overall health")
+
+	resp, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: services.HealthKafka})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func TestHealthFollowsPostgres(t *testing.T) {
+	hs := health.NewServer()
+	client := startHealthServer(t, hs)
+
+	services.UpdateHealth(hs, map[string]error{
+		services.HealthPostgres: errors.New("database not initialized"),
+		services.HealthRedis:    nil,
+		services.HealthKafka:    nil,
+	})
+
+	for _, service := range []string{"", "notification.NotificationService", services.HealthPostgres} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status, "service %q", service)
+	}
+
+	hs.Shutdown()
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: services.HealthRedis})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status, "Expected NOT_SERVING after shutdown")
+}
@@ -0,0 +1,112 @@
+package grpcTests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"user-notification-api/middleware"
+	"user-notification-api/services"
+
+	pb "user-notification-api/proto"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// stubServer echoes the authenticated caller instead of touching the DB
+type stubServer struct {
+	pb.UnimplementedNotificationServiceServer
+}
+
+func (s *stubServer) GetNotification(ctx context.Context, req *pb.GetNotificationRequest) (*pb.Notification, error) {
+	p, _ := services.PrincipalFromContext(ctx)
+	return &pb.Notification{Id: req.Id, Status: p.Role, Email: p.Name}, nil
+}
+
+func (s *stubServer) SendNotification(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
+	panic("boom")
+}
+
+// dialBufconn serves the registered services with the production interceptor
+// chain over an in-memory listener and returns a client connection to it.
+func dialBufconn(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(middleware.GRPCUnaryInterceptors(), middleware.GRPCStreamInterceptors())
+	register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func startServer(t *testing.T) pb.NotificationServiceClient {
+	conn := dialBufconn(t, func(srv *grpc.Server) {
+		pb.RegisterNotificationServiceServer(srv, &stubServer{})
+	})
+	return pb.NewNotificationServiceClient(conn)
+}
+
+func signToken(t *testing.T, role string, twoFA bool) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":   7,
+		"role": role,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"2fa":  twoFA,
+	})
+	s, err := token.SignedString(services.JWTSecret())
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return s
+}
+
+func TestGRPCRequiresCredentials(t *testing.T) {
+	client := startServer(t)
+	_, err := client.GetNotification(context.Background(), &pb.GetNotificationRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signToken(t, "user", false))
+	_, err = client.GetNotification(ctx, &pb.GetNotificationRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Expected partial token rejected")
+}
+
+func TestGRPCPermissions(t *testing.T) {
+	client := startServer(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signToken(t, "user", true))
+
+	resp, err := client.GetNotification(ctx, &pb.GetNotificationRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "user", resp.Status)
+
+	_, err = client.SendNotification(ctx, &pb.NotificationRequest{Email: "a@example.com"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "Expected users unable to send")
+}
+
+func TestGRPCAPIKeyAndRecovery(t *testing.T) {
+	t.Setenv("API_KEYS", "billing:s3cret")
+	client := startServer(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "s3cret", "x-request-id", "req-42")
+
+	var header metadata.MD
+	resp, err := client.GetNotification(ctx, &pb.GetNotificationRequest{Id: 1}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, "service", resp.Status)
+	assert.Equal(t, []string{"req-42"}, header.Get("x-request-id"))
+
+	_, err = client.SendNotification(ctx, &pb.NotificationRequest{Email: "a@example.com"})
+	assert.Equal(t, codes.Internal, status.Code(err), "Expected panic converted to Internal")
+}
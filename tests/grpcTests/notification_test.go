@@ -0,0 +1,157 @@
+package grpcTests
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+	"user-notification-api/tests/testutils"
+
+	pb "user-notification-api/proto"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNotificationReadsAreScopedToTheCaller(t *testing.T) {
+	srv := &services.NotificationServer{}
+	tests := []struct {
+		name    string
+		caller  *services.Principal
+		allowed bool
+	}{
+		{"no caller", nil, false},
+		{"API key with a custom role", &services.Principal{Name: "reports", Role: "reporting"}, false},
+		{"user without an ID", &services.Principal{Role: "user"}, false},
+		{"unknown role with a user ID", &services.Principal{UserID: 7, Role: "guest"}, true},
+		{"user", &services.Principal{UserID: 7, Role: "user"}, true},
+		{"service", &services.Principal{Name: "billing", Role: "service"}, true},
+		{"admin", &services.Principal{UserID: 1, Role: "admin"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.caller != nil {
+				ctx = services.ContextWithPrincipal(ctx, tt.caller)
+			}
+			_, listErr := srv.ListNotifications(ctx, &pb.ListNotificationsRequest{})
+			_, getErr := srv.GetNotification(ctx, &pb.GetNotificationRequest{Id: 1})
+			_, cancelErr := srv.CancelNotification(ctx, &pb.CancelNotificationRequest{Id: 1})
+			for _, err := range []error{listErr, getErr, cancelErr} {
+				// Allowed callers reach the database, which may not be running here
+				denied := status.Code(err) == codes.PermissionDenied
+				assert.Equal(t, !tt.allowed, denied, "%v", err)
+			}
+		})
+	}
+}
+
+func TestNotificationServerOwnership(t *testing.T) {
+	testutils.RequireDB(t)
+	srv := &services.NotificationServer{}
+	alice := services.ContextWithPrincipal(context.Background(), &services.Principal{UserID: 7, Role: "user"})
+	bob := services.ContextWithPrincipal(context.Background(), &services.Principal{UserID: 8, Role: "user"})
+	admin := services.ContextWithPrincipal(context.Background(), &services.Principal{UserID: 1, Role: "admin"})
+	email := uuid.NewString() + "@example.com"
+	key := "grpc-" + uuid.NewString()
+	send := func(ctx context.Context, key string) *pb.NotificationResponse {
+		resp, err := srv.SendNotification(ctx, &pb.NotificationRequest{Email: email, Subject: "Hi", Message: "Hello",
+			IdempotencyKey: key, SendAt: timestamppb.New(time.Now().Add(time.Hour))})
+		assert.NoError(t, err)
+		assert.True(t, resp.Success, resp.Error)
+		return resp
+	}
+
+	first := send(alice, key)
+	assert.False(t, first.Duplicate)
+	assert.Equal(t, models.NotificationScheduled, first.Status)
+	bobs := send(bob, "")
+
+	sends := []struct {
+		name          string
+		ctx           context.Context
+		wantDuplicate bool
+	}{
+		{"same key from the same user", alice, true},
+		{"same key from another user", bob, false},
+	}
+	for _, tt := range sends {
+		t.Run("send "+tt.name, func(t *testing.T) {
+			resp := send(tt.ctx, key)
+			assert.Equal(t, tt.wantDuplicate, resp.Duplicate)
+			assert.Equal(t, tt.wantDuplicate, resp.Id == first.Id)
+		})
+	}
+
+	lists := []struct {
+		name string
+		ctx  context.Context
+		want int // notifications to email visible to the caller
+	}{
+		{"user sees their own", alice, 1},
+		{"other user sees theirs", bob, 2},
+		{"admin sees all", admin, 3},
+	}
+	for _, tt := range lists {
+		t.Run("list "+tt.name, func(t *testing.T) {
+			resp, err := srv.ListNotifications(tt.ctx, &pb.ListNotificationsRequest{Email: email})
+			assert.NoError(t, err)
+			assert.Len(t, resp.Notifications, tt.want)
+		})
+	}
+
+	cancels := []struct {
+		name     string
+		ctx      context.Context
+		id       int64
+		wantCode codes.Code
+	}{
+		{"another user's", bob, first.Id, codes.NotFound},
+		{"own", alice, first.Id, codes.OK},
+		{"own again", alice, first.Id, codes.FailedPrecondition},
+		{"any as admin", admin, bobs.Id, codes.OK},
+	}
+	for _, tt := range cancels {
+		t.Run("cancel "+tt.name, func(t *testing.T) {
+			n, err := srv.CancelNotification(tt.ctx, &pb.CancelNotificationRequest{Id: tt.id})
+			assert.Equal(t, tt.wantCode, status.Code(err), "%v", err)
+			if err == nil {
+				assert.Equal(t, models.NotificationCancelled, n.Status)
+			}
+		})
+	}
+	n, err := srv.GetNotification(admin, &pb.GetNotificationRequest{Id: first.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NotificationCancelled, n.Status, "Expected only the owner's cancel to apply")
+}
+
+func TestAPIKeysHaveTheirOwnIdempotencyKeys(t *testing.T) {
+	testutils.RequireDB(t)
+	srv := &services.NotificationServer{}
+	billing := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "billing", Role: "service"})
+	reports := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "reports", Role: "service"})
+	key := "shared-" + uuid.NewString()
+	send := func(ctx context.Context) *pb.NotificationResponse {
+		resp, err := srv.SendNotification(ctx, &pb.NotificationRequest{Email: "keys@example.com", Subject: "Hi",
+			Message: "Hello", IdempotencyKey: key, SendAt: timestamppb.New(time.Now().Add(time.Hour))})
+		assert.NoError(t, err)
+		assert.True(t, resp.Success, resp.Error)
+		return resp
+	}
+
+	first := send(billing)
+	other := send(reports)
+	assert.False(t, other.Duplicate, "Expected another API key's notification with the same key to be new")
+	assert.NotEqual(t, first.Id, other.Id)
+	again := send(billing)
+	assert.True(t, again.Duplicate)
+	assert.Equal(t, first.Id, again.Id)
+
+	n, err := services.GetNotification(context.Background(), other.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "reports", n.CreatedByName, "Expected the creating API key to be recorded")
+}
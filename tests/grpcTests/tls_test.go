@@ -0,0 +1,107 @@
+package grpcTests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"user-notification-api/config"
+	"user-notification-api/middleware"
+
+	pb "user-notification-api/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeCert signs a certificate with ca (self-signed if ca is nil) and writes
+// cert and key PEM files into dir.
+func writeCert(t *testing.T, dir, name string, tmpl *x509.Certificate, ca *testCA) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := tmpl, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeCert(t, dir, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	writeCert(t, dir, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	serverTLS, err := config.ServerTLS(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	assert.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)), middleware.GRPCUnaryInterceptors())
+	pb.RegisterNotificationServiceServer(srv, &stubServer{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dial := func(certFile, keyFile string) pb.NotificationServiceClient {
+		clientTLS, err := config.ClientTLS(filepath.Join(dir, "ca.crt"), certFile, keyFile, "localhost")
+		assert.NoError(t, err)
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewNotificationServiceClient(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := dial(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	resp, err := client.GetNotification(ctx, &pb.GetNotificationRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "service", resp.Status)
+	assert.Equal(t, "spiffe://example.org/billing", resp.Email, "Expected identity from URI SAN")
+
+	_, err = dial("", "").GetNotification(ctx, &pb.GetNotificationRequest{Id: 1})
+	assert.Error(t, err, "Expected handshake failure without client certificate")
+}
@@ -0,0 +1,87 @@
+package jobTests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobAdminRetriesAndDeletesJobs(t *testing.T) {
+	q, rdb := newQueue(t)
+	ctx := context.Background()
+	fail := true
+	services.HandleJob(q, "greet", services.JobOptions{MaxAttempts: 1}, func(ctx context.Context, p greeting) error {
+		if fail {
+			return errors.New("mailbox full")
+		}
+		return nil
+	})
+
+	id, _ := q.Enqueue(ctx, "greet", greeting{Name: "Ada"})
+	q.ProcessNext(ctx)
+	failed, err := q.ListJobs(ctx, models.JobFailed, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, id, failed[0].ID)
+		assert.Equal(t, "mailbox full", failed[0].LastError)
+		assert.JSONEq(t, `{"name":"Ada"}`, string(failed[0].Payload))
+	}
+
+	_, err = q.RetryJob(ctx, "missing")
+	assert.ErrorIs(t, err, services.ErrJobNotFound)
+	fail = false
+	job, err := q.RetryJob(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, job.Attempts, "Expected a fresh set of attempts")
+	_, err = q.RetryJob(ctx, id)
+	assert.ErrorIs(t, err, services.ErrJobNotFailed)
+	q.ProcessNext(ctx)
+
+	counts, err := q.Counts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), counts[models.JobFailed])
+	assert.Equal(t, int64(1), counts[models.JobCompleted])
+
+	assert.NoError(t, q.DeleteJob(ctx, id))
+	assert.ErrorIs(t, q.DeleteJob(ctx, id), services.ErrJobNotFound)
+	assert.Equal(t, int64(0), rdb.LLen(ctx, "test:completed").Val())
+	assert.Equal(t, int64(0), rdb.HLen(ctx, "test:data").Val())
+}
+
+func TestJobAdminPausesJobTypes(t *testing.T) {
+	q, _ := newQueue(t)
+	ctx := context.Background()
+	var ran []string
+	for _, jobType := range []string{"greet", "wave"} {
+		jobType := jobType
+		services.HandleJob(q, jobType, services.JobOptions{}, func(ctx context.Context, p greeting) error {
+			ran = append(ran, jobType+" "+p.Name)
+			return nil
+		})
+	}
+
+	assert.ErrorIs(t, q.PauseType(ctx, "unknown"), services.ErrUnknownJobType)
+	assert.NoError(t, q.PauseType(ctx, "greet"))
+	q.Enqueue(ctx, "greet", greeting{Name: "Ada"})
+	q.Enqueue(ctx, "wave", greeting{Name: "Ada"})
+	q.Enqueue(ctx, "greet", greeting{Name: "Grace"})
+	for i := 0; i < 3; i++ {
+		q.ProcessNext(ctx)
+	}
+	assert.Equal(t, []string{"wave Ada"}, ran, "Expected only jobs of running types to run")
+	paused, err := q.ListJobs(ctx, models.JobPaused, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, paused, 2)
+
+	n, err := q.ResumeType(ctx, "greet")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	for i := 0; i < 2; i++ {
+		q.ProcessNext(ctx)
+	}
+	assert.Equal(t, []string{"wave Ada", "greet Ada", "greet Grace"}, ran, "Expected set-aside jobs to run in order")
+}
@@ -0,0 +1,162 @@
+package jobTests
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-notification-api/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func newQueue(t *testing.T) (*services.JobQueue, *redis.Client) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	q := services.NewJobQueue(rdb, "test")
+	q.PollTimeout = 100 * time.Millisecond
+	q.Backoff = func(int) time.Duration { return 0 }
+	return q, rdb
+}
+
+func TestJobQueueRunsTypedJobs(t *testing.T) {
+	q, rdb := newQueue(t)
+	ctx := context.Background()
+	var got string
+	services.HandleJob(q, "greet", services.JobOptions{}, func(ctx context.Context, p greeting) error {
+		got = p.Name
+		return nil
+	})
+
+	_, err := q.Enqueue(ctx, "greet", greeting{Name: "Ada"})
+	assert.NoError(t, err)
+	ok, err := q.ProcessNext(ctx)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", got)
+
+	ok, err = q.ProcessNext(ctx)
+	assert.False(t, ok, "Expected the queue to be empty")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rdb.LLen(ctx, "test:completed").Val(), "Expected finished jobs kept as completed")
+	assert.Equal(t, int64(0), rdb.LLen(ctx, "test:processing").Val())
+}
+
+func TestJobQueueRetriesFailedJobs(t *testing.T) {
+	q, rdb := newQueue(t)
+	ctx := context.Background()
+	var calls int
+	services.HandleJob(q, "flaky", services.JobOptions{MaxAttempts: 3}, func(ctx context.Context, p greeting) error {
+		calls++
+		if calls < 2 {
+			return errors.New("smtp unavailable")
+		}
+		return nil
+	})
+	services.HandleJob(q, "broken", services.JobOptions{MaxAttempts: 2}, func(ctx context.Context, p greeting) error {
+		return errors.New("always fails")
+	})
+	services.HandleJob(q, "invalid", services.JobOptions{}, func(ctx context.Context, p greeting) error {
+		return services.PermanentJobError(errors.New("no such user"))
+	})
+
+	q.Enqueue(ctx, "flaky", greeting{})
+	q.ProcessNext(ctx)
+	assert.Equal(t, int64(1), rdb.ZCard(ctx, "test:delayed").Val(), "Expected the failed job scheduled for a retry")
+	ok, _ := q.ProcessNext(ctx)
+	assert.False(t, ok, "Expected the retry to wait in the delayed set")
+	assert.NoError(t, q.Maintain(ctx))
+	q.ProcessNext(ctx)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, int64(1), rdb.LLen(ctx, "test:completed").Val())
+
+	q.Enqueue(ctx, "broken", greeting{})
+	q.ProcessNext(ctx)
+	q.Maintain(ctx)
+	q.ProcessNext(ctx)
+	assert.Equal(t, int64(1), rdb.LLen(ctx, "test:dead").Val(), "Expected the job dead after its last attempt")
+
+	q.Enqueue(ctx, "invalid", greeting{})
+	q.Enqueue(ctx, "unknown", greeting{})
+	q.ProcessNext(ctx)
+	q.ProcessNext(ctx)
+	assert.Equal(t, int64(3), rdb.LLen(ctx, "test:dead").Val(), "Expected permanent failures and unknown types not retried")
+	assert.Equal(t, int64(0), rdb.ZCard(ctx, "test:delayed").Val())
+}
+
+func TestJobQueueRequeuesExpiredLeases(t *testing.T) {
+	q, rdb := newQueue(t)
+	ctx := context.Background()
+	var calls atomic.Int32
+	stalled := make(chan struct{})
+	services.HandleJob(q, "slow", services.JobOptions{Timeout: 50 * time.Millisecond}, func(ctx context.Context, p greeting) error {
+		if calls.Add(1) == 1 {
+			<-stalled // ignores its deadline, like a hung worker
+		}
+		return nil
+	})
+
+	q.Enqueue(ctx, "slow", greeting{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.ProcessNext(ctx)
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+
+	assert.NoError(t, q.Maintain(ctx))
+	ok, err := q.ProcessNext(ctx)
+	assert.True(t, ok, "Expected the job handed to another worker")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	close(stalled)
+	<-done
+	assert.Equal(t, int64(1), rdb.LLen(ctx, "test:completed").Val(), "Expected the job completed once")
+	assert.Equal(t, int64(0), rdb.LLen(ctx, "test:processing").Val())
+	assert.Equal(t, int64(0), rdb.LLen(ctx, "test:dead").Val(), "Expected the stalled worker not to settle the job again")
+}
+
+func TestJobQueueFinishesRunningJobsOnShutdown(t *testing.T) {
+	q, rdb := newQueue(t)
+	started := make(chan struct{})
+	var handlerErr atomic.Value
+	services.HandleJob(q, "slow", services.JobOptions{Timeout: time.Second}, func(ctx context.Context, p greeting) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		if err := ctx.Err(); err != nil {
+			handlerErr.Store(err)
+		}
+		return ctx.Err()
+	})
+	_, err := q.Enqueue(context.Background(), "slow", greeting{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Run to return once the running job finished")
+	}
+
+	bg := context.Background()
+	assert.Nil(t, handlerErr.Load(), "Expected the running job not to be cancelled by shutdown")
+	assert.Equal(t, int64(1), rdb.LLen(bg, "test:completed").Val(), "Expected the job settled as completed")
+	assert.Equal(t, int64(0), rdb.LLen(bg, "test:processing").Val())
+}
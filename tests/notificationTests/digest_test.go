@@ -0,0 +1,108 @@
+package notificationTests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"user-notification-api/models"
+	"user-notification-api/services"
+	"user-notification-api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sentEmail struct{ to, subject, message string }
+
+// captureEmails records emails instead of sending them until the test ends
+func captureEmails(t *testing.T) func(to string) []sentEmail {
+	var mu sync.Mutex
+	var sent []sentEmail
+	services.SetEmailSender(func(to, subject, message string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, sentEmail{to, subject, message})
+		return nil
+	})
+	t.Cleanup(func() { services.SetEmailSender(nil) })
+	return func(to string) []sentEmail {
+		mu.Lock()
+		defer mu.Unlock()
+		var out []sentEmail
+		for _, e := range sent {
+			if e.to == to {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+}
+
+// holdForDigest stores notifications for userID as if Dispatch had held them
+func holdForDigest(t *testing.T, userID int, email string, subjects ...string) []int64 {
+	var ids []int64
+	for _, subject := range subjects {
+		n := &models.Notification{UserID: userID, Email: email, Subject: subject,
+			Message: subject + " body", Status: models.NotificationDigest}
+		_, err := services.ScheduleNotification(context.Background(), n)
+		assert.NoError(t, err)
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func notificationStatus(t *testing.T, id int64) string {
+	n, err := services.GetNotification(context.Background(), id)
+	assert.NoError(t, err)
+	return n.Status
+}
+
+func TestSendDueDigestsSendsHeldNotifications(t *testing.T) {
+	testutils.RequireDB(t)
+	useRedis(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	userID := 1_000_000 + rand.Intn(1_000_000)
+	email := fmt.Sprintf("digest-%d@example.com", userID)
+
+	assert.NoError(t, services.SavePreferences(ctx, userID,
+		&models.NotificationPreferences{DigestFrequency: models.DigestHourly}))
+	ids := holdForDigest(t, userID, email, "Build passed", "New comment")
+
+	assert.NoError(t, services.SendDueDigests(ctx))
+	sent := sentTo(email)
+	if assert.Len(t, sent, 1, "Expected one digest for all held notifications") {
+		assert.Contains(t, sent[0].subject, "2 notifications")
+		assert.Contains(t, sent[0].message, "Build passed")
+		assert.Contains(t, sent[0].message, "New comment")
+	}
+	for _, id := range ids {
+		assert.Equal(t, models.NotificationSent, notificationStatus(t, id))
+	}
+
+	// The next digest is not due for another hour
+	holdForDigest(t, userID, email, "Later")
+	assert.NoError(t, services.SendDueDigests(ctx))
+	assert.Len(t, sentTo(email), 1, "Expected no second digest within the period")
+}
+
+func TestSendDueDigestsReleasesHeldNotificationsWhenDigestIsOff(t *testing.T) {
+	testutils.RequireDB(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	userID := 2_000_000 + rand.Intn(1_000_000)
+	email := fmt.Sprintf("digest-%d@example.com", userID)
+
+	assert.NoError(t, services.SavePreferences(ctx, userID,
+		&models.NotificationPreferences{DigestFrequency: models.DigestDaily}))
+	ids := holdForDigest(t, userID, email, "Weekly report")
+	assert.NoError(t, services.SavePreferences(ctx, userID,
+		&models.NotificationPreferences{DigestFrequency: models.DigestOff}))
+
+	assert.NoError(t, services.SendDueDigests(ctx))
+	assert.Empty(t, sentTo(email), "Expected no digest once the user turned it off")
+	n, err := services.GetNotification(ctx, ids[0])
+	assert.NoError(t, err)
+	assert.Equal(t, models.NotificationScheduled, n.Status, "Expected the notification back with the scheduler")
+}
@@ -0,0 +1,128 @@
+package notificationTests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"user-notification-api/models"
+	"user-notification-api/services"
+	"user-notification-api/tests/testutils"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	redisOnce sync.Once
+	redisMR   *miniredis.Miniredis
+)
+
+// useRedis points the services package at an in-memory Redis shared by the
+// tests in this package; InitRedis keeps the first client it connects
+func useRedis(t *testing.T) *miniredis.Miniredis {
+	redisOnce.Do(func() {
+		mr, err := miniredis.Run()
+		if err != nil {
+			return
+		}
+		os.Setenv("REDIS_HOST", mr.Addr())
+		if services.InitRedis() != nil {
+			redisMR = mr
+		}
+	})
+	if redisMR == nil {
+		t.Skip("Redis not available")
+	}
+	redisMR.FlushAll()
+	return redisMR
+}
+
+func TestDeliverEmailOncePerSenderAndKey(t *testing.T) {
+	useRedis(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	const email = "dedup@example.com"
+	alice, bob := services.NotificationOwner(7, ""), services.NotificationOwner(8, "")
+
+	assert.NoError(t, services.DeliverEmail(ctx, alice, "invoice-1", email, "Invoice", "Due"))
+	err := services.DeliverEmail(ctx, alice, "invoice-1", email, "Invoice", "Due")
+	assert.ErrorIs(t, err, services.ErrDuplicateNotification)
+	assert.Len(t, sentTo(email), 1)
+
+	// Another sender's key is their own
+	assert.NoError(t, services.DeliverEmail(ctx, bob, "invoice-1", email, "Invoice", "Due"))
+	assert.Len(t, sentTo(email), 2, "Expected another sender's key not to suppress the email")
+}
+
+func TestDeliverEmailWaitsForRedis(t *testing.T) {
+	mr := useRedis(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	const email = "redis-down@example.com"
+	alice := services.NotificationOwner(7, "")
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	err := services.DeliverEmail(ctx, alice, "invoice-2", email, "Invoice", "Due")
+	mr.SetError("")
+	assert.ErrorIs(t, err, services.ErrIdempotencyUnavailable)
+	assert.Empty(t, sentTo(email), "Expected nothing sent while keys cannot be checked")
+
+	// The retry goes through once Redis is back, and only once
+	assert.NoError(t, services.DeliverEmail(ctx, alice, "invoice-2", email, "Invoice", "Due"))
+	assert.ErrorIs(t, services.DeliverEmail(ctx, alice, "invoice-2", email, "Invoice", "Due"), services.ErrDuplicateNotification)
+	assert.Len(t, sentTo(email), 1)
+}
+
+func TestDeliverEmailWithoutKeyIsNotDeduplicated(t *testing.T) {
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	const email = "no-key@example.com"
+	alice := services.NotificationOwner(7, "")
+
+	assert.NoError(t, services.DeliverEmail(ctx, alice, "", email, "Hi", "Hello"))
+	assert.NoError(t, services.DeliverEmail(ctx, alice, "", email, "Hi", "Hello"))
+	assert.Len(t, sentTo(email), 2)
+}
+
+func TestDeliverEmailKeysOfAPIKeysAreSeparate(t *testing.T) {
+	useRedis(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	const email = "api-keys@example.com"
+	owners := []string{
+		services.NotificationOwner(0, "billing"),
+		services.NotificationOwner(0, "reports"),
+		services.NotificationOwner(0, ""), // the system, e.g. welcome emails
+	}
+	for _, owner := range owners {
+		assert.NoError(t, services.DeliverEmail(ctx, owner, "welcome:"+email, email, "Hi", "Hello"), owner)
+	}
+	assert.Len(t, sentTo(email), 3, "Expected API keys not to share the system's keys or each other's")
+	assert.ErrorIs(t, services.DeliverEmail(ctx, owners[0], "welcome:"+email, email, "Hi", "Hello"),
+		services.ErrDuplicateNotification)
+}
+
+func TestRedeliveredNotificationIsMarkedSent(t *testing.T) {
+	testutils.RequireDB(t)
+	useRedis(t)
+	sentTo := captureEmails(t)
+	ctx := context.Background()
+	email := uuid.NewString() + "@example.com"
+	n := &models.Notification{Email: email, Subject: "Receipt", Message: "Thanks", CreatedBy: 7}
+	_, err := services.ScheduleNotification(ctx, n)
+	assert.NoError(t, err)
+	msg := services.RegistrationMessage{Email: email, Subject: n.Subject, Message: n.Message, CreatedBy: 7,
+		IdempotencyKey: fmt.Sprintf("notification:%d", n.ID), NotificationID: n.ID}
+
+	// The first delivery sent the email but stopped before recording it
+	owner := services.NotificationOwner(msg.CreatedBy, "")
+	assert.NoError(t, services.DeliverEmail(ctx, owner, msg.IdempotencyKey, email, msg.Subject, msg.Message))
+	result, err := services.Dispatch(ctx, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, services.DispatchDuplicate, result)
+	assert.Len(t, sentTo(email), 1)
+	assert.Equal(t, models.NotificationSent, notificationStatus(t, n.ID))
+}
@@ -0,0 +1,37 @@
+package notificationTests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboxRetention(t *testing.T) {
+	t.Setenv("INBOX_RETENTION", "")
+	assert.Equal(t, 30*24*time.Hour, services.InboxRetention())
+
+	t.Setenv("INBOX_RETENTION", "168h")
+	assert.Equal(t, 7*24*time.Hour, services.InboxRetention())
+
+	for _, v := range []string{"a week", "-1h", "0s"} {
+		t.Setenv("INBOX_RETENTION", v)
+		assert.Equal(t, 30*24*time.Hour, services.InboxRetention(), "Expected default for %q", v)
+	}
+}
+
+func TestUnreadCountEvent(t *testing.T) {
+	data, err := json.Marshal(services.Event{Type: services.EventUnreadCount, Data: models.UnreadCount{Unread: 3}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"unread_count","data":{"unread":3}}`, string(data))
+
+	data, err = json.Marshal(models.InboxItem{ID: 7, Category: "account", Subject: "Hi"})
+	assert.NoError(t, err)
+	var item map[string]interface{}
+	json.Unmarshal(data, &item)
+	assert.Equal(t, false, item["read"])
+	assert.NotContains(t, item, "read_at", "Expected read_at omitted while unread")
+}
@@ -0,0 +1,123 @@
+package notificationTests
+
+import (
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietHoursWrapMidnight(t *testing.T) {
+	q := &models.QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}
+	loc, _ := time.LoadLocation("Europe/Berlin")
+
+	quiet, until := services.QuietUntil(q, time.Date(2026, 3, 10, 23, 30, 0, 0, loc))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 3, 11, 7, 0, 0, 0, loc), until)
+
+	quiet, until = services.QuietUntil(q, time.Date(2026, 3, 10, 6, 59, 0, 0, loc))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 3, 10, 7, 0, 0, 0, loc), until)
+
+	quiet, _ = services.QuietUntil(q, time.Date(2026, 3, 10, 12, 0, 0, 0, loc))
+	assert.False(t, quiet, "Expected midday outside quiet hours")
+}
+
+func TestQuietHoursEndOnClockChangeDays(t *testing.T) {
+	q := &models.QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}
+	loc, _ := time.LoadLocation("Europe/Berlin")
+
+	// Clocks go forward at 02:00 on 29 March and back at 03:00 on 25 October
+	for _, now := range []time.Time{
+		time.Date(2026, 3, 28, 23, 30, 0, 0, loc),
+		time.Date(2026, 3, 29, 1, 0, 0, 0, loc),
+		time.Date(2026, 10, 24, 23, 30, 0, 0, loc),
+		time.Date(2026, 10, 25, 1, 0, 0, 0, loc),
+	} {
+		quiet, until := services.QuietUntil(q, now)
+		assert.True(t, quiet, now.String())
+		assert.Equal(t, 7, until.In(loc).Hour(), "Expected quiet hours from %s to end at 07:00, got %s", now, until)
+	}
+
+	q = &models.QuietHours{Start: "01:00", End: "06:00", Timezone: "Europe/Berlin"}
+	quiet, _ := services.QuietUntil(q, time.Date(2026, 3, 29, 6, 30, 0, 0, loc))
+	assert.False(t, quiet, "Expected 06:30 after quiet hours on the day clocks go forward")
+}
+
+func TestQuietHoursUseUserTimezone(t *testing.T) {
+	q := &models.QuietHours{Start: "09:00", End: "17:00", Timezone: "America/New_York"}
+	// 15:00 UTC is 10:00 in New York in January
+	quiet, _ := services.QuietUntil(q, time.Date(2026, 1, 15, 15, 0, 0, 0, time.UTC))
+	assert.True(t, quiet)
+	quiet, _ = services.QuietUntil(q, time.Date(2026, 1, 15, 23, 0, 0, 0, time.UTC))
+	assert.False(t, quiet)
+}
+
+func TestCheckDelivery(t *testing.T) {
+	prefs := &models.NotificationPreferences{
+		Channels: []models.ChannelPreference{
+			{Category: models.CategoryMarketing, Channel: models.ChannelEmail, Enabled: false},
+		},
+		QuietHours: &models.QuietHours{Start: "00:00", End: "23:59", Timezone: "UTC"},
+	}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	decision, _ := services.CheckDelivery(prefs, models.CategoryMarketing, models.ChannelEmail, now)
+	assert.Equal(t, services.DeliverySuppress, decision, "Expected marketing email suppressed")
+
+	decision, until := services.CheckDelivery(prefs, models.CategoryGeneral, models.ChannelEmail, now)
+	assert.Equal(t, services.DeliveryDefer, decision, "Expected deferral during quiet hours")
+	assert.Equal(t, time.Date(2026, 5, 1, 23, 59, 0, 0, time.UTC), until)
+
+	decision, _ = services.CheckDelivery(prefs, models.CategorySecurity, models.ChannelEmail, now)
+	assert.Equal(t, services.DeliveryAllow, decision, "Expected security alerts always delivered")
+
+	decision, _ = services.CheckDelivery(nil, models.CategoryMarketing, models.ChannelEmail, now)
+	assert.Equal(t, services.DeliveryAllow, decision, "Expected delivery without preferences")
+
+	decision, _ = services.CheckDelivery(prefs, models.CategoryMarketing, models.ChannelInApp, now)
+	assert.NotEqual(t, services.DeliverySuppress, decision, "Expected email opt-out not to affect in-app")
+}
+
+func TestValidatePreferencesRejectsDisablingSecurity(t *testing.T) {
+	prefs := &models.NotificationPreferences{
+		Channels: []models.ChannelPreference{
+			{Category: models.CategorySecurity, Channel: models.ChannelEmail, Enabled: false},
+		},
+	}
+	assert.Error(t, services.ValidatePreferences(prefs))
+}
+
+func TestValidatePreferencesChannels(t *testing.T) {
+	prefs := &models.NotificationPreferences{
+		Channels: []models.ChannelPreference{
+			{Category: models.CategoryMarketing, Channel: models.ChannelInApp, Enabled: false},
+		},
+	}
+	assert.NoError(t, services.ValidatePreferences(prefs))
+
+	prefs.Channels[0].Channel = "sms"
+	assert.Error(t, services.ValidatePreferences(prefs))
+}
+
+func TestUsesDigest(t *testing.T) {
+	prefs := &models.NotificationPreferences{DigestFrequency: models.DigestDaily}
+	assert.True(t, services.UsesDigest(prefs, models.CategoryMarketing, models.PriorityNormal))
+	assert.False(t, services.UsesDigest(prefs, models.CategoryGeneral, models.PriorityHigh), "Expected urgent notifications sent immediately")
+	assert.False(t, services.UsesDigest(prefs, models.CategorySecurity, models.PriorityLow), "Expected security alerts sent immediately")
+	assert.False(t, services.UsesDigest(&models.NotificationPreferences{DigestFrequency: models.DigestOff}, models.CategoryGeneral, models.PriorityLow))
+}
+
+func TestRenderDigest(t *testing.T) {
+	created := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	body, err := services.RenderDigest(models.DigestHourly, []*models.Notification{
+		{Subject: "New follower", Message: "Ada followed you", CreatedAt: created},
+		{Subject: "Weekly tips", Message: "Try dark mode", CreatedAt: created},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, body, "hourly summary with 2 notifications")
+	assert.Contains(t, body, "- New follower (May 1 09:30 UTC)")
+	assert.Contains(t, body, "Try dark mode")
+}
@@ -0,0 +1,142 @@
+package notificationTests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-notification-api/handlers"
+	"user-notification-api/models"
+	"user-notification-api/services"
+	"user-notification-api/tests/testutils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKeysArePerCreator(t *testing.T) {
+	testutils.RequireDB(t)
+	ctx := context.Background()
+	key := "order-" + uuid.NewString()
+	schedule := func(createdBy int, email string) (*models.Notification, bool) {
+		n := &models.Notification{Email: email, Subject: "Receipt", Message: "Thanks " + email,
+			IdempotencyKey: key, CreatedBy: createdBy, SendAt: time.Now().Add(time.Hour)}
+		duplicate, err := services.ScheduleNotification(ctx, n)
+		assert.NoError(t, err)
+		return n, duplicate
+	}
+
+	first, duplicate := schedule(1, "alice@example.com")
+	assert.False(t, duplicate)
+	again, duplicate := schedule(1, "alice@example.com")
+	assert.True(t, duplicate, "Expected the creator's repeated key to be a duplicate")
+	assert.Equal(t, first.ID, again.ID)
+
+	other, duplicate := schedule(2, "mallory@example.com")
+	assert.False(t, duplicate, "Expected another creator's key to be a new notification")
+	assert.NotEqual(t, first.ID, other.ID)
+	assert.Equal(t, "mallory@example.com", other.Email, "Expected no other creator's notification returned")
+}
+
+func TestScheduleAndCancelNotification(t *testing.T) {
+	testutils.RequireDB(t)
+	ctx := context.Background()
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	key := "reminder-" + uuid.NewString()
+	schedule := func(createdBy int, key string) (*models.Notification, bool) {
+		n := &models.Notification{Email: "schedule@example.com", Subject: "Reminder", Message: "Meeting at 10",
+			IdempotencyKey: key, CreatedBy: createdBy, SendAt: sendAt}
+		duplicate, err := services.ScheduleNotification(ctx, n)
+		assert.NoError(t, err)
+		return n, duplicate
+	}
+	first, _ := schedule(7, key)
+	assert.Equal(t, models.NotificationScheduled, first.Status)
+	assert.True(t, sendAt.Equal(first.SendAt), "Expected send_at to be kept")
+
+	tests := []struct {
+		name          string
+		createdBy     int
+		key           string
+		wantDuplicate bool
+	}{
+		{"same creator and key", 7, key, true},
+		{"same key from another creator", 8, key, false},
+		{"no key", 7, "", false},
+		{"no key again", 7, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, duplicate := schedule(tt.createdBy, tt.key)
+			assert.Equal(t, tt.wantDuplicate, duplicate)
+			assert.Equal(t, tt.wantDuplicate, n.ID == first.ID)
+			assert.Equal(t, tt.createdBy, n.CreatedBy)
+		})
+	}
+
+	cancels := []struct {
+		name    string
+		id      int64
+		wantErr error
+	}{
+		{"scheduled", first.ID, nil},
+		{"already cancelled", first.ID, services.ErrNotificationNotCancellable},
+		{"unknown", -1, services.ErrNotificationNotFound},
+	}
+	for _, tt := range cancels {
+		t.Run("cancel "+tt.name, func(t *testing.T) {
+			err := services.CancelNotification(ctx, tt.id)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+	n, err := services.GetNotification(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NotificationCancelled, n.Status)
+}
+
+func TestNotificationScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		caller    *services.Principal
+		wantScope int
+		wantErr   bool
+	}{
+		{"no caller", nil, 0, true},
+		{"API key with a custom role", &services.Principal{Name: "reports", Role: "reporting"}, 0, true},
+		{"user", &services.Principal{UserID: 7, Role: "user"}, 7, false},
+		{"service", &services.Principal{Name: "billing", Role: "service"}, 0, false},
+		{"admin", &services.Principal{UserID: 1, Role: "admin"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := services.NotificationScope(tt.caller)
+			assert.Equal(t, tt.wantErr, errors.Is(err, services.ErrNotificationAccessDenied))
+			assert.Equal(t, tt.wantScope, scope)
+		})
+	}
+}
+
+func TestNotificationRoutesCheckPermissions(t *testing.T) {
+	request := func(method, role string, userID int) int {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("user_id", userID)
+			c.Locals("role", role)
+			return c.Next()
+		})
+		handlers.SetupNotificationRoutes(app)
+		resp, err := app.Test(httptest.NewRequest(method, "/notifications/1", nil))
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, fiber.StatusForbidden, request(http.MethodDelete, "user", 7), "Expected users not to cancel, as over gRPC")
+	assert.Equal(t, fiber.StatusForbidden, request(http.MethodGet, "reporting", 0))
+	assert.NotEqual(t, fiber.StatusForbidden, request(http.MethodGet, "service", 0), "Expected services to see every notification")
+}
@@ -0,0 +1,95 @@
+package notificationTests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-notification-api/handlers"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCategory(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", models.CategoryGeneral, false},
+		{"marketing", models.CategoryMarketing, false},
+		{" Marketing ", models.CategoryMarketing, false},
+		{"SECURITY", models.CategorySecurity, false},
+		{"promo", "", true},
+		{"market ing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := services.NormalizeCategory(tt.in)
+		assert.Equal(t, tt.wantErr, err != nil, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestSendNotificationRejectsUnknownCategory(t *testing.T) {
+	sentTo := captureEmails(t)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", 7)
+		return c.Next()
+	})
+	app.Post("/notifications", handlers.SendNotification)
+	send := func(category string) int {
+		body, _ := json.Marshal(fiber.Map{"email": "category@example.com", "category": category,
+			"subject": "Sale", "message": "50% off"})
+		req := httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusBadRequest, send("promo"))
+	assert.Equal(t, fiber.StatusBadRequest, send("marketing!"))
+	assert.Empty(t, sentTo("category@example.com"), "Expected unknown categories not to be delivered")
+
+	assert.Equal(t, fiber.StatusOK, send("Marketing"))
+	assert.Len(t, sentTo("category@example.com"), 1)
+}
+
+func TestSendNotificationRequiresSendPermission(t *testing.T) {
+	sentTo := captureEmails(t)
+	const email = "permission@example.com"
+	send := func(role string) int {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("user_id", 7)
+			c.Locals("role", role)
+			return c.Next()
+		})
+		handlers.SetupNotificationRoutes(app)
+		body, _ := json.Marshal(fiber.Map{"email": email, "subject": "Hi", "message": "Hello"})
+		req := httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{"user", fiber.StatusForbidden},
+		{"", fiber.StatusForbidden},
+		{"reporting", fiber.StatusForbidden},
+		{"service", fiber.StatusOK},
+		{"admin", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, send(tt.role), "role %q", tt.role)
+	}
+	assert.Len(t, sentTo(email), 2, "Expected only admins and services to send")
+}
@@ -0,0 +1,165 @@
+package outboxTests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"user-notification-api/services"
+	"user-notification-api/tests/testutils"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryOutbox is an OutboxStore with the same lease rules as the table
+type memoryOutbox struct {
+	mu     sync.Mutex
+	now    time.Time
+	rows   []services.OutboxMessage
+	leased map[int64]time.Time
+	sent   map[int64]bool
+}
+
+func newMemoryOutbox(n int) *memoryOutbox {
+	o := &memoryOutbox{now: time.Now(), leased: map[int64]time.Time{}, sent: map[int64]bool{}}
+	for i := 1; i <= n; i++ {
+		o.rows = append(o.rows, services.OutboxMessage{ID: int64(i), Topic: "user-registration", Key: "k", Payload: []byte(`{}`)})
+	}
+	return o
+}
+
+func (o *memoryOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]services.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []services.OutboxMessage
+	for _, m := range o.rows {
+		if len(out) == limit {
+			break
+		}
+		if o.sent[m.ID] || o.leased[m.ID].After(o.now) {
+			continue
+		}
+		o.leased[m.ID] = o.now.Add(lease)
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (o *memoryOutbox) MarkSent(ctx context.Context, ids []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ids {
+		o.sent[id] = true
+		delete(o.leased, id)
+	}
+	return nil
+}
+
+func (o *memoryOutbox) Release(ctx context.Context, ids []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ids {
+		delete(o.leased, id)
+	}
+	return nil
+}
+
+func (o *memoryOutbox) unsent() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.rows) - len(o.sent)
+}
+
+// fakeWriter records published messages and fails while err is set
+type fakeWriter struct {
+	err       error
+	published []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.published = append(w.published, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func TestRelayOutboxPublishesAndMarksSent(t *testing.T) {
+	store := newMemoryOutbox(3)
+	w := &fakeWriter{}
+
+	n, err := services.RelayOutbox(context.Background(), store, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Len(t, w.published, 3)
+	assert.Equal(t, 0, store.unsent())
+
+	n, err = services.RelayOutbox(context.Background(), store, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "Expected sent rows not to be published again")
+	assert.Len(t, w.published, 3)
+}
+
+func TestRelayOutboxClaimsInBatches(t *testing.T) {
+	store := newMemoryOutbox(250)
+	w := &fakeWriter{}
+
+	n, err := services.RelayOutbox(context.Background(), store, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, int64(1), store.rows[0].ID)
+	assert.Equal(t, 150, store.unsent())
+}
+
+func TestRelayOutboxRetriesAfterPublishFailure(t *testing.T) {
+	store := newMemoryOutbox(2)
+	w := &fakeWriter{err: errors.New("kafka unavailable")}
+
+	n, err := services.RelayOutbox(context.Background(), store, w)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, store.unsent(), "Expected failed rows to stay pending")
+
+	w.err = nil
+	n, err = services.RelayOutbox(context.Background(), store, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n, "Expected released rows to be claimed again on the next poll")
+	assert.Len(t, w.published, 2)
+	assert.Equal(t, 0, store.unsent())
+}
+
+func TestPostgresOutboxLeasesClaimedRows(t *testing.T) {
+	db := testutils.RequireDB(t)
+	ctx := context.Background()
+	topic := "outbox-test-" + uuid.NewString()
+	assert.NoError(t, services.EnqueueOutbox(ctx, db, topic, "k", map[string]string{"hello": "world"}))
+	store := services.PostgresOutbox{}
+	claim := func() []int64 {
+		msgs, err := store.Claim(ctx, 1000, time.Minute)
+		assert.NoError(t, err)
+		var ids []int64
+		for _, m := range msgs {
+			if m.Topic == topic {
+				ids = append(ids, m.ID)
+			}
+		}
+		return ids
+	}
+
+	ids := claim()
+	assert.Len(t, ids, 1)
+	assert.Empty(t, claim(), "Expected a claimed row to be skipped while leased")
+
+	assert.NoError(t, store.Release(ctx, ids))
+	ids = claim()
+	assert.Len(t, ids, 1, "Expected a released row to be claimable again")
+
+	assert.NoError(t, store.MarkSent(ctx, ids))
+	assert.NoError(t, store.Release(ctx, ids))
+	assert.Empty(t, claim(), "Expected a sent row never to be claimed again")
+}
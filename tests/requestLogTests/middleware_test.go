@@ -0,0 +1,49 @@
+package requestLogTests
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-notification-api/middleware"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingQueuesRequestsIntact(t *testing.T) {
+	rec := &recorder{}
+	p := services.NewRequestLogPublisher(100, rec.write)
+	p.FlushInterval = 10 * time.Millisecond
+	services.SetRequestLogPublisher(p)
+	defer services.SetRequestLogPublisher(nil)
+
+	app := fiber.New()
+	app.Use(middleware.Logging())
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusTeapot) })
+	for _, path := range []string{"/first-request", "/other-request"} {
+		req := httptest.NewRequest("GET", path+"?token=secret", nil)
+		req.Header.Set("User-Agent", "agent"+path)
+		_, err := app.Test(req)
+		assert.NoError(t, err)
+	}
+
+	// Entries are read only now, after fasthttp has reused the request buffers
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx)
+	var logs []models.RequestLog
+	for _, b := range rec.batches {
+		logs = append(logs, b...)
+	}
+	if assert.Len(t, logs, 2) {
+		for i, path := range []string{"/first-request", "/other-request"} {
+			assert.Equal(t, "GET", logs[i].Method)
+			assert.Equal(t, path, logs[i].Path, "Expected the path without the query string")
+			assert.Equal(t, "agent"+path, logs[i].UserAgent)
+			assert.Equal(t, fiber.StatusTeapot, logs[i].Status)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package requestLogTests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]models.RequestLog
+}
+
+func (r *recorder) write(ctx context.Context, batch []models.RequestLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, append([]models.RequestLog(nil), batch...))
+	return nil
+}
+
+func (r *recorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sizes []int
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestRequestLogPublisherNeverBlocks(t *testing.T) {
+	p := services.NewRequestLogPublisher(2, (&recorder{}).write)
+	assert.True(t, p.Publish(models.RequestLog{Path: "/a"}))
+	assert.True(t, p.Publish(models.RequestLog{Path: "/b"}))
+	assert.False(t, p.Publish(models.RequestLog{Path: "/c"}), "Expected entries dropped while the buffer is full")
+}
+
+func TestRequestLogPublisherBatches(t *testing.T) {
+	rec := &recorder{}
+	p := services.NewRequestLogPublisher(100, rec.write)
+	p.BatchSize = 3
+	p.FlushInterval = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	for i := 0; i < 4; i++ {
+		p.Publish(models.RequestLog{Path: "/notifications", Status: 200})
+	}
+	assert.Eventually(t, func() bool { return len(rec.sizes()) == 2 }, time.Second, 5*time.Millisecond,
+		"Expected a full batch, then the rest after the flush interval")
+	assert.Equal(t, []int{3, 1}, rec.sizes())
+
+	p.Publish(models.RequestLog{Path: "/rooms", Status: 404})
+	cancel()
+	<-done
+	assert.Equal(t, []int{3, 1, 1}, rec.sizes(), "Expected queued entries written on shutdown")
+}
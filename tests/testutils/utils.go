@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 	"user-notification-api/handlers"
+	"user-notification-api/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5"
@@ -63,6 +64,16 @@ func (r *MockRow) Scan(dest ...interface{}) error {
 	return nil
 }
 
+// RequireDB returns the database configured by the POSTGRES_* variables and
+// skips t when it is not reachable
+func RequireDB(t *testing.T) services.DBInterface {
+	d := services.DB()
+	if d == nil {
+		t.Skip("Postgres not available")
+	}
+	return d
+}
+
 func SetupTestApp() *fiber.App {
 	app := fiber.New()
 	app.Post("/register", handlers.Register)
@@ -74,6 +85,9 @@ func SetupTestApp() *fiber.App {
 	return app
 }
 
+// GetValidToken registers a user, grants it role and returns its access
+// token. Registration always creates users, so other roles are granted in
+// the database, as an operator would.
 func GetValidToken(t *testing.T, app *fiber.App, role string) string {
 	if app == nil {
 		t.Fatal("App is nil")
@@ -83,11 +97,9 @@ func GetValidToken(t *testing.T, app *fiber.App, role string) string {
 	payload := struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
-		Role     string `json:"role"`
 	}{
 		Email:    uniqueEmail,
 		Password: password,
-		Role:     role,
 	}
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -112,6 +124,11 @@ func GetValidToken(t *testing.T, app *fiber.App, role string) string {
 		t.Fatalf("Failed <nil>Failed to decode register response: %v", err)
 	}
 	totpSecret := regResult["totp_secret"]
+	if role != services.DefaultRole {
+		if _, err := RequireDB(t).Exec(context.Background(), "UPDATE users SET role = $1 WHERE email = $2", role, uniqueEmail); err != nil {
+			t.Fatalf("Failed to grant role %s: %v", role, err)
+		}
+	}
 
 	// Ensure DB commit by waiting briefly
 	time.Sleep(100 * time.Millisecond)
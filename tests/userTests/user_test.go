@@ -1,9 +1,13 @@
 package usertests
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 	"user-notification-api/tests/testutils"
 
 	"github.com/gofiber/fiber/v2"
@@ -21,3 +25,19 @@ func TestAdminRoute(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, fiber.StatusOK, resp.StatusCode, "Expected admin access")
 }
+
+func TestRegisterIgnoresRequestedRole(t *testing.T) {
+	db := testutils.RequireDB(t)
+	app := testutils.SetupTestApp()
+	email := fmt.Sprintf("test+%d@example.com", time.Now().UnixNano())
+	body := fmt.Sprintf(`{"email":%q,"password":"password123","role":"admin"}`, email)
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 5000)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var role string
+	assert.NoError(t, db.QueryRow(context.Background(), "SELECT role FROM users WHERE email = $1", email).Scan(&role))
+	assert.Equal(t, "user", role, "Expected a self-registered account never to be an admin")
+}
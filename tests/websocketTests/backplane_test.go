@@ -0,0 +1,98 @@
+package websocketTests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	"user-notification-api/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// startInstance runs a hub and backplane as one replica would
+func startInstance(t *testing.T, mr *miniredis.Miniredis) (*services.Hub, *services.Backplane) {
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	hub := services.NewHub()
+	b := services.NewBackplane(hub, rdb)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	before := mr.PubSubNumSub(services.BackplaneChannel)[services.BackplaneChannel]
+	go b.Run(ctx)
+	assert.Eventually(t, func() bool {
+		return mr.PubSubNumSub(services.BackplaneChannel)[services.BackplaneChannel] > before
+	}, time.Second, 10*time.Millisecond, "Expected instance subscribed")
+	return hub, b
+}
+
+func written(f *fakeConn) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, v := range f.written {
+		data, _ := json.Marshal(v)
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func TestBackplaneReachesOtherInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hubA, backplaneA := startInstance(t, mr)
+	hubB, _ := startInstance(t, mr)
+
+	onA, onB, otherOnB := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	hubA.Register(42, onA)
+	hubB.Register(42, onB)
+	hubB.Register(7, otherOnB)
+
+	event := services.Event{Type: services.EventNotification, Data: map[string]string{"subject": "hi"}}
+	assert.Equal(t, 1, backplaneA.Notify(42, event), "Expected local delivery count")
+
+	expected := `{"type":"notification","data":{"subject":"hi"}}`
+	assert.Eventually(t, func() bool { return len(written(onB)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.JSONEq(t, expected, written(onB)[0])
+
+	// The publishing instance must not deliver its own message twice
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, written(onA), 1)
+	assert.JSONEq(t, expected, written(onA)[0])
+	assert.Empty(t, written(otherOnB))
+
+	backplaneA.Broadcast(map[string]string{"message": "all"})
+	assert.Eventually(t, func() bool { return len(written(otherOnB)) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestBackplaneFallsBackToLocalDelivery(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hub, b := startInstance(t, mr)
+	conn := &fakeConn{}
+	hub.Register(42, conn)
+
+	mr.Close()
+	assert.Equal(t, 1, b.Notify(42, "still here"), "Expected local delivery without Redis")
+}
+
+func TestBackplaneRooms(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hubA, backplaneA := startInstance(t, mr)
+	hubB, _ := startInstance(t, mr)
+
+	member, outsider := &fakeConn{}, &fakeConn{}
+	memberClient := hubB.Register(42, member)
+	hubB.Register(7, outsider)
+	hubB.Join(memberClient, "ops")
+
+	assert.Equal(t, 0, backplaneA.PublishRoom("ops", map[string]string{"message": "deploying"}))
+	assert.Eventually(t, func() bool { return len(written(member)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, written(outsider))
+
+	// Removing a member on one instance unsubscribes their connections on all
+	assert.Equal(t, 0, backplaneA.RemoveFromRoom("ops", 42))
+	assert.Eventually(t, func() bool { return !hubB.InRoom(memberClient, "ops") }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, hubA.PublishRoom("ops", "local only"))
+}
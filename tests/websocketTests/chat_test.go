@@ -0,0 +1,150 @@
+package websocketTests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func frames(f *fakeConn) []models.ChatFrame {
+	var out []models.ChatFrame
+	for _, s := range written(f) {
+		var frame models.ChatFrame
+		json.Unmarshal([]byte(s), &frame)
+		out = append(out, frame)
+	}
+	return out
+}
+
+func TestAuthorizeRoomJoin(t *testing.T) {
+	public := &models.ChatRoom{Name: "general"}
+	private := &models.ChatRoom{Name: "staff", Private: true}
+
+	assert.NoError(t, services.AuthorizeRoomJoin(public, "user", false))
+	assert.NoError(t, services.AuthorizeRoomJoin(private, "user", true), "Expected members admitted")
+	assert.NoError(t, services.AuthorizeRoomJoin(private, "admin", false), "Expected admins admitted")
+	assert.Equal(t, services.ErrRoomForbidden, services.AuthorizeRoomJoin(private, "user", false))
+
+	assert.True(t, services.CanManageRoom("user", models.RoomOwner))
+	assert.True(t, services.CanManageRoom("admin", ""))
+	assert.False(t, services.CanManageRoom("user", models.RoomMember))
+
+	assert.NoError(t, services.ValidateRoomName("team-42_ops"))
+	for _, name := range []string{"", "Team", "-ops", "a b", "dm:1:2"} {
+		assert.Equal(t, services.ErrInvalidRoomName, services.ValidateRoomName(name), name)
+	}
+}
+
+func TestHubRooms(t *testing.T) {
+	hub := services.NewHub()
+	phone, laptop, other := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	phoneClient := hub.Register(42, phone)
+	laptopClient := hub.Register(42, laptop)
+	otherClient := hub.Register(7, other)
+
+	assert.True(t, hub.Join(phoneClient, "ops"))
+	assert.True(t, hub.Join(otherClient, "ops"))
+	assert.True(t, hub.Join(laptopClient, "dev"))
+	assert.Equal(t, 2, hub.PublishRoom("ops", "deploying"))
+	eventually(t, func() bool { return phone.count() == 1 && other.count() == 1 }, "Expected room subscribers notified")
+	assert.Equal(t, 0, laptop.count(), "Expected rooms to be per connection")
+
+	assert.True(t, hub.Leave(otherClient, "ops"))
+	assert.False(t, hub.Leave(otherClient, "ops"), "Expected second leave to report not subscribed")
+	assert.Equal(t, 1, hub.PublishRoom("ops", "done"))
+
+	assert.Equal(t, 2, hub.RemoveFromRoom("ops", 42)+hub.RemoveFromRoom("dev", 42))
+	assert.False(t, hub.InRoom(phoneClient, "ops"))
+	assert.Equal(t, 0, hub.PublishRoom("dev", "gone"))
+
+	hub.Join(otherClient, "ops")
+	hub.Unregister(otherClient)
+	assert.Equal(t, 0, hub.PublishRoom("ops", "gone"), "Expected unregistered connection removed from rooms")
+	assert.False(t, hub.Join(otherClient, "ops"), "Expected join refused after unregister")
+}
+
+func TestHandleChatFrame(t *testing.T) {
+	hub := services.WSHub()
+	sender, senderLaptop, recipient := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	client := hub.Register(4201, sender)
+	defer hub.Unregister(client)
+	defer hub.Unregister(hub.Register(4201, senderLaptop))
+	defer hub.Unregister(hub.Register(4207, recipient))
+	ctx := context.Background()
+
+	// Direct frames reach the recipient and the sender's other devices
+	services.HandleChatFrame(ctx, client, "user", &models.ChatFrame{Type: models.ChatTyping, To: 4207})
+	eventually(t, func() bool { return recipient.count() == 1 && senderLaptop.count() == 1 && sender.count() == 1 }, "Expected direct frame delivered")
+	dm := frames(recipient)[0]
+	assert.Equal(t, models.ChatTyping, dm.Type)
+	assert.Equal(t, 4201, dm.From)
+	assert.Equal(t, 4207, dm.To)
+
+	// Sending to a room requires joining it first
+	services.HandleChatFrame(ctx, client, "user", &models.ChatFrame{Type: models.ChatMessage, ID: "c2", Room: "ops", Message: "hi"})
+	eventually(t, func() bool { return sender.count() == 2 }, "Expected error reply")
+	assert.Equal(t, models.ChatFrame{Type: models.ChatError, Ref: "c2", Room: "ops", Error: services.ErrNotInRoom.Error(), SentAt: frames(sender)[1].SentAt}, frames(sender)[1])
+
+	hub.Join(client, "ops")
+	services.HandleChatFrame(ctx, client, "user", &models.ChatFrame{Type: models.ChatTyping, Room: "ops"})
+	eventually(t, func() bool { return sender.count() == 3 }, "Expected typing relayed to the room")
+	assert.Equal(t, models.ChatTyping, frames(sender)[2].Type, "Expected no ack for typing")
+	assert.Equal(t, 1, recipient.count(), "Expected non-members not to see room traffic")
+}
+
+func TestReplayPrecedesLiveMessages(t *testing.T) {
+	hub := services.NewHub()
+	conn := &fakeConn{}
+	loaded := make(chan struct{})
+	missed := []models.ChatFrame{
+		{Type: models.ChatMessage, ID: "11", Room: "ops", Message: "missed"},
+		{Type: models.ChatMessage, ID: "12", Room: "ops", Message: "also missed"},
+	}
+	client := hub.RegisterReplay(42, conn, func() ([]models.ChatFrame, error) {
+		<-loaded
+		return missed, nil
+	})
+
+	// Live traffic while the history loads waits behind it; a message that
+	// was stored in time to be replayed is not written twice
+	hub.Join(client, "ops")
+	hub.PublishRoom("ops", models.ChatFrame{Type: models.ChatMessage, ID: "12", Room: "ops", Message: "also missed"})
+	hub.PublishRoom("ops", json.RawMessage(`{"type":"message","id":"13","room":"ops","message":"live"}`))
+	hub.Notify(42, services.Event{Type: services.EventNotification})
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, conn.count(), "Expected nothing written before the replay")
+	close(loaded)
+
+	eventually(t, func() bool { return conn.count() == 4 }, "Expected replay then live messages")
+	got := frames(conn)
+	assert.Equal(t, []string{"11", "12", "13", ""}, []string{got[0].ID, got[1].ID, got[2].ID, got[3].ID})
+	assert.Equal(t, services.EventNotification, got[3].Type)
+
+	// Joining another room with a replay works the same way
+	assert.NoError(t, hub.JoinReplay(client, "dev", func() ([]models.ChatFrame, error) {
+		return []models.ChatFrame{{Type: models.ChatMessage, ID: "14", Room: "dev", Message: "earlier"}}, nil
+	}))
+	hub.PublishRoom("dev", models.ChatFrame{Type: models.ChatMessage, ID: "15", Room: "dev", Message: "now"})
+	eventually(t, func() bool { return conn.count() == 6 }, "Expected room replay")
+	assert.Equal(t, "14", frames(conn)[4].ID)
+	assert.Equal(t, "15", frames(conn)[5].ID)
+}
+
+func TestReplayFailureIsReported(t *testing.T) {
+	hub := services.NewHub()
+	conn := &fakeConn{}
+	hub.RegisterReplay(42, conn, func() ([]models.ChatFrame, error) {
+		return nil, errors.New("database not available")
+	})
+	hub.Notify(42, "live")
+
+	eventually(t, func() bool { return conn.count() == 2 }, "Expected error then live message")
+	assert.Equal(t, models.ChatError, frames(conn)[0].Type)
+	assert.False(t, conn.isClosed())
+}
@@ -0,0 +1,171 @@
+package websocketTests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConn records what the hub writes. With block set, writes wait until
+// the channel is closed, simulating a client that stopped reading.
+type fakeConn struct {
+	mu        sync.Mutex
+	written   []interface{}
+	pings     int
+	fail      bool
+	closed    bool
+	block     chan struct{}
+	deadlines int
+	attempts  int
+}
+
+func (f *fakeConn) WriteJSON(v interface{}) error {
+	f.mu.Lock()
+	f.attempts++
+	f.mu.Unlock()
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("broken pipe")
+	}
+	f.written = append(f.written, v)
+	return nil
+}
+
+func (f *fakeConn) WriteMessage(messageType int, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pings++
+	return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (f *fakeConn) SetWriteDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deadlines++
+	return nil
+}
+
+func (f *fakeConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (f *fakeConn) SetPongHandler(h func(appData string) error) {}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeConn) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.written)
+}
+
+func (f *fakeConn) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	assert.Eventually(t, cond, time.Second, 5*time.Millisecond, msg)
+}
+
+func TestHubNotifiesAllDevicesOfOneUser(t *testing.T) {
+	hub := services.NewHub()
+	phone, laptop, other := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	hub.Register(42, phone)
+	hub.Register(42, laptop)
+	hub.Register(7, other)
+
+	event := services.Event{Type: services.EventNotification, Data: "hello"}
+	assert.Equal(t, 2, hub.Notify(42, event))
+	eventually(t, func() bool { return phone.count() == 1 && laptop.count() == 1 }, "Expected both devices notified")
+	assert.Equal(t, []interface{}{event}, phone.written)
+	assert.Equal(t, 0, other.count(), "Expected other users not notified")
+
+	assert.Equal(t, 0, hub.Notify(99, event), "Expected no connections for offline user")
+	assert.Equal(t, 3, hub.Broadcast("all"))
+	eventually(t, func() bool { return other.count() == 1 }, "Expected broadcast delivered")
+}
+
+func TestHubPreservesOrderAndSetsDeadlines(t *testing.T) {
+	hub := services.NewHub()
+	conn := &fakeConn{}
+	client := hub.Register(42, conn)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, client.Send(i))
+	}
+	eventually(t, func() bool { return conn.count() == 10 }, "Expected all messages written")
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, conn.written)
+	assert.Equal(t, 10, conn.deadlines, "Expected a write deadline per message")
+}
+
+func TestHubPings(t *testing.T) {
+	hub := services.NewHub()
+	hub.PingInterval = 10 * time.Millisecond
+	conn := &fakeConn{}
+	hub.Register(42, conn)
+
+	eventually(t, func() bool {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return conn.pings >= 2
+	}, "Expected periodic pings")
+}
+
+func TestHubSlowConsumerDoesNotBlockOthers(t *testing.T) {
+	hub := services.NewHub()
+	hub.QueueSize = 2
+	hub.MaxDrops = 3
+	slow, fast := &fakeConn{block: make(chan struct{})}, &fakeConn{}
+	defer close(slow.block)
+	slowClient := hub.Register(42, slow)
+	hub.Register(7, fast)
+
+	// The slow writer holds one message and queues two; the rest are dropped
+	hub.Broadcast(0)
+	eventually(t, func() bool {
+		slow.mu.Lock()
+		defer slow.mu.Unlock()
+		return slow.attempts == 1
+	}, "Expected slow writer blocked")
+	hub.Broadcast(1)
+	hub.Broadcast(2)
+	eventually(t, func() bool { return fast.count() == 3 }, "Expected fast client unaffected")
+
+	assert.Equal(t, services.ErrQueueFull, slowClient.Send("a"))
+	assert.Equal(t, services.ErrQueueFull, slowClient.Send("b"))
+	assert.Equal(t, services.ErrQueueFull, slowClient.Send("c"))
+	eventually(t, slow.isClosed, "Expected slow consumer disconnected")
+	assert.Equal(t, services.ErrClientClosed, slowClient.Send("d"))
+}
+
+func TestHubDropsFailedConnections(t *testing.T) {
+	hub := services.NewHub()
+	good, bad := &fakeConn{}, &fakeConn{fail: true}
+	hub.Register(42, good)
+	badClient := hub.Register(42, bad)
+
+	assert.Equal(t, 2, hub.Notify(42, "ping"), "Expected message queued for both devices")
+	eventually(t, bad.isClosed, "Expected failed connection closed")
+	eventually(t, func() bool { return hub.Connections(42) == 1 }, "Expected failed connection unregistered")
+
+	// The handler unregisters again when its read loop ends
+	hub.Unregister(badClient)
+	assert.Equal(t, 1, hub.Connections(42))
+}
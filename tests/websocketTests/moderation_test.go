@@ -0,0 +1,73 @@
+package websocketTests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := services.NewTokenBucket(5, 10)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		assert.True(t, b.AllowAt(now), "Expected the burst to be allowed")
+	}
+	assert.False(t, b.AllowAt(now), "Expected frames past the burst to be refused")
+
+	assert.True(t, b.AllowAt(now.Add(200*time.Millisecond)), "Expected one token after 1/rate seconds")
+	assert.False(t, b.AllowAt(now.Add(200*time.Millisecond)))
+
+	later := now.Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		assert.True(t, b.AllowAt(later))
+	}
+	assert.False(t, b.AllowAt(later), "Expected tokens capped at the burst")
+}
+
+func TestCheckChatMessage(t *testing.T) {
+	services.SetChatFilters(
+		services.WordFilter([]string{"darn", " heck "}),
+		services.LinkFilter([]string{"example.com"}),
+	)
+	defer services.SetChatFilters()
+
+	msg, err := services.CheckChatMessage("Darn it, what the heck")
+	assert.NoError(t, err)
+	assert.Equal(t, "**** it, what the ****", msg)
+	msg, _ = services.CheckChatMessage("darned")
+	assert.Equal(t, "darned", msg, "Expected only whole words masked")
+
+	_, err = services.CheckChatMessage("see https://docs.example.com/page and www.example.com")
+	assert.NoError(t, err, "Expected allowed domains and their subdomains to pass")
+	_, err = services.CheckChatMessage("free stuff at http://evil.test/x")
+	assert.Equal(t, services.ErrLinksNotAllowed, err)
+	_, err = services.CheckChatMessage("www.example.com.evil.test")
+	assert.Equal(t, services.ErrLinksNotAllowed, err)
+
+	_, err = services.CheckChatMessage("  ")
+	assert.Equal(t, services.ErrMessageEmpty, err)
+	_, err = services.CheckChatMessage(strings.Repeat("é", services.MaxChatMessageLength+1))
+	assert.Equal(t, services.ErrMessageTooLong, err)
+}
+
+func TestHandleChatFrameRejectsFilteredMessages(t *testing.T) {
+	services.SetChatFilters(services.LinkFilter(nil))
+	defer services.SetChatFilters()
+
+	hub := services.WSHub()
+	conn := &fakeConn{}
+	client := hub.Register(4301, conn)
+	defer hub.Unregister(client)
+	hub.Join(client, "ops")
+
+	services.HandleChatFrame(context.Background(), client, "user", &models.ChatFrame{Type: models.ChatMessage, ID: "c1", Room: "ops", Message: "http://evil.test"})
+	eventually(t, func() bool { return conn.count() == 1 }, "Expected error reply")
+	assert.Equal(t, models.ChatError, frames(conn)[0].Type)
+	assert.Equal(t, "c1", frames(conn)[0].Ref)
+	assert.Equal(t, services.ErrLinksNotAllowed.Error(), frames(conn)[0].Error)
+}
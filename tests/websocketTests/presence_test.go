@@ -0,0 +1,89 @@
+package websocketTests
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresenceAcrossDevices(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var changes []string
+	tracker := services.NewPresenceTracker(rdb)
+	tracker.OnChange = func(p models.Presence) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, p.Status)
+	}
+
+	hub := services.NewHub()
+	phone, laptop := hub.Register(42, &fakeConn{}), hub.Register(42, &fakeConn{})
+	assert.NoError(t, tracker.Connect(ctx, phone))
+	assert.NoError(t, tracker.Connect(ctx, laptop))
+	assert.NoError(t, tracker.SetAway(ctx, phone, true))
+
+	p, err := tracker.Get(ctx, 42)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PresenceOnline, p.Status, "Expected online while one device is active")
+
+	assert.NoError(t, tracker.SetAway(ctx, laptop, true))
+	assert.NoError(t, tracker.Heartbeat(ctx))
+	p, _ = tracker.Get(ctx, 42)
+	assert.Equal(t, models.PresenceAway, p.Status, "Expected away once every device is away")
+
+	assert.NoError(t, tracker.Disconnect(ctx, phone))
+	assert.NoError(t, tracker.Disconnect(ctx, laptop))
+	p, _ = tracker.Get(ctx, 42)
+	assert.Equal(t, models.PresenceOffline, p.Status)
+	if assert.NotNil(t, p.LastSeen) {
+		assert.WithinDuration(t, time.Now(), *p.LastSeen, 2*time.Second)
+	}
+	assert.Equal(t, []string{models.PresenceOnline, models.PresenceAway, models.PresenceOffline}, changes,
+		"Expected only status changes reported")
+
+	p, _ = tracker.Get(ctx, 7)
+	assert.Equal(t, models.Presence{UserID: 7, Status: models.PresenceOffline}, p, "Expected unknown users offline")
+}
+
+func TestPresenceExpiresStaleConnections(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	// A connection from an instance that stopped sending heartbeats
+	stale := float64(time.Now().Add(-time.Minute).Unix())
+	mr.ZAdd("presence:42:active", stale, "crashed-instance-conn")
+	mr.Set("presence:42:last_seen", strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+
+	p, err := services.NewPresenceTracker(rdb).Get(ctx, 42)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PresenceOffline, p.Status)
+	assert.False(t, mr.Exists("presence:42:active"), "Expected stale connection removed")
+}
+
+func TestNotifyLoginReachesOpenSockets(t *testing.T) {
+	conn := &fakeConn{}
+	client := services.WSHub().Register(4301, conn)
+	defer services.WSHub().Unregister(client)
+
+	services.NotifyLogin(4301, "203.0.113.7", "cli")
+	eventually(t, func() bool { return conn.count() == 1 }, "Expected welcome_back event")
+	event := conn.written[0].(services.Event)
+	assert.Equal(t, services.EventWelcomeBack, event.Type)
+	assert.Equal(t, "Welcome back!", event.Data.(services.LoginEvent).Message)
+	assert.Equal(t, "203.0.113.7", event.Data.(services.LoginEvent).IP)
+}
@@ -0,0 +1,84 @@
+package websocketTests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+	"user-notification-api/models"
+	"user-notification-api/services"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSEConnWritesEvents(t *testing.T) {
+	var buf bytes.Buffer
+	conn := services.NewSSEConn(bufio.NewWriter(&buf))
+
+	assert.NoError(t, conn.WriteJSON(services.Event{Type: services.EventNotification, Data: &models.InboxItem{ID: 7, Subject: "Hi"}}))
+	assert.NoError(t, conn.WriteJSON(services.Event{Type: services.EventUnreadCount, Data: models.UnreadCount{Unread: 1}}))
+	assert.NoError(t, conn.WriteMessage(websocket.PingMessage, nil))
+
+	events := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n\n")), []byte("\n\n"))
+	assert.Len(t, events, 3)
+	assert.True(t, bytes.HasPrefix(events[0], []byte("id: 7\ndata: {")), "Expected inbox notifications to carry their ID")
+	assert.Equal(t, `data: {"type":"unread_count","data":{"unread":1}}`, string(events[1]))
+	assert.Equal(t, ": ping", string(events[2]))
+
+	assert.NoError(t, conn.Close())
+	<-conn.Done()
+	assert.ErrorIs(t, conn.WriteJSON(services.Event{Type: services.EventNotification}), services.ErrClientClosed)
+}
+
+func TestInboxReplayPrecedesLiveEvents(t *testing.T) {
+	hub := services.NewHub()
+	conn := &fakeConn{}
+	loaded := make(chan struct{})
+	hub.RegisterInboxReplay(42, conn, func() ([]models.InboxItem, error) {
+		<-loaded
+		return []models.InboxItem{{ID: 11}, {ID: 12}}, nil
+	})
+
+	// Item 12 was stored before the replay loaded it, so its live copies are
+	// skipped, whether queued here or relayed by the backplane
+	hub.Notify(42, services.Event{Type: services.EventNotification, Data: &models.InboxItem{ID: 12}})
+	hub.Notify(42, json.RawMessage(`{"type":"notification","data":{"id":12}}`))
+	hub.Notify(42, json.RawMessage(`{"type":"notification","data":{"id":13}}`))
+	hub.Notify(42, services.Event{Type: services.EventUnreadCount, Data: models.UnreadCount{Unread: 3}})
+	close(loaded)
+
+	eventually(t, func() bool { return conn.count() == 4 }, "Expected replay then live events")
+	var ids []int64
+	for _, v := range conn.written {
+		data, _ := json.Marshal(v)
+		var e struct {
+			Data struct {
+				ID int64 `json:"id"`
+			} `json:"data"`
+		}
+		json.Unmarshal(data, &e)
+		ids = append(ids, e.Data.ID)
+	}
+	assert.Equal(t, []int64{11, 12, 13, 0}, ids)
+}
+
+// Runs last among the SSE tests: once streams are closed, new ones are refused
+func TestCloseSSEStreamsEndsOpenStreams(t *testing.T) {
+	open := services.NewSSEConn(bufio.NewWriter(&bytes.Buffer{}))
+	services.CloseSSEStreams()
+
+	select {
+	case <-open.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected open streams to be closed")
+	}
+	late := services.NewSSEConn(bufio.NewWriter(&bytes.Buffer{}))
+	select {
+	case <-late.Done():
+	default:
+		t.Fatal("Expected streams opened during shutdown to be closed")
+	}
+	assert.ErrorIs(t, late.WriteJSON(services.Event{Type: services.EventNotification}), services.ErrClientClosed)
+}
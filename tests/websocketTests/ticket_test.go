@@ -0,0 +1,98 @@
+package websocketTests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-notification-api/middleware"
+	"user-notification-api/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWSTicketIsSingleUse(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	ticket, err := services.IssueWSTicket(ctx, rdb, &services.Principal{UserID: 7, Role: "user"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ticket)
+
+	p, err := services.ConsumeWSTicket(ctx, rdb, ticket)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, p.UserID)
+	assert.Equal(t, "user", p.Role)
+
+	_, err = services.ConsumeWSTicket(ctx, rdb, ticket)
+	assert.ErrorIs(t, err, services.ErrInvalidTicket, "Expected a ticket to work only once")
+}
+
+func TestWSTicketExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	ticket, err := services.IssueWSTicket(ctx, rdb, &services.Principal{UserID: 7, Role: "user"})
+	assert.NoError(t, err)
+	mr.FastForward(services.WSTicketTTL + time.Second)
+
+	_, err = services.ConsumeWSTicket(ctx, rdb, ticket)
+	assert.ErrorIs(t, err, services.ErrInvalidTicket, "Expected the ticket to expire")
+}
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := middleware.AllowedOrigins("https://app.example.com/, https://Admin.example.com")
+
+	assert.False(t, middleware.CheckOrigin("", "api.example.com", allowed), "Expected a missing origin to need header credentials")
+	assert.True(t, middleware.CheckOrigin("https://api.example.com", "api.example.com", allowed), "Expected same origin to pass")
+	assert.True(t, middleware.CheckOrigin("https://app.example.com", "api.example.com", allowed))
+	assert.True(t, middleware.CheckOrigin("https://admin.example.com", "api.example.com", allowed))
+	assert.False(t, middleware.CheckOrigin("https://evil.example.com", "api.example.com", allowed))
+	assert.False(t, middleware.CheckOrigin("https://api.example.com:8443", "api.example.com", allowed))
+
+	assert.True(t, middleware.CheckOrigin("https://evil.example.com", "api.example.com", middleware.AllowedOrigins("*")))
+}
+
+func TestWSAuthCredentials(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id": 7, "role": "user", "2fa": true, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	jwtStr, err := token.SignedString(services.JWTSecret())
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/ws", middleware.WSAuth(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	tests := []struct {
+		name    string
+		query   string
+		headers map[string]string
+		want    int
+	}{
+		{"JWT in the header without origin", "", map[string]string{"Authorization": "Bearer " + jwtStr}, fiber.StatusOK},
+		{"JWT in the query", "?token=" + jwtStr, nil, fiber.StatusForbidden},
+		{"JWT in the query from the same origin", "?token=" + jwtStr, map[string]string{"Origin": "http://example.com"}, fiber.StatusUnauthorized},
+		{"ticket without origin", "?ticket=abc", nil, fiber.StatusForbidden},
+		{"ticket from another origin", "?ticket=abc", map[string]string{"Origin": "https://evil.example.com"}, fiber.StatusForbidden},
+		{"no credentials", "", nil, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/ws"+tt.query, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}